@@ -0,0 +1,98 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// alertName is the alertname label of every alert the watchdog raises, for
+// routing and silences in Alertmanager.
+const alertName = "IrmaWatchdog"
+
+// alert is an alert in the form of Alertmanager's /api/v2/alerts.
+type alert struct {
+	Labels      map[string]string `json:"labels"`
+	Annotations map[string]string `json:"annotations"`
+	StartsAt    time.Time         `json:"startsAt"`
+	EndsAt      time.Time         `json:"endsAt"`
+}
+
+func newAlert(issue issueEntry, endsAt time.Time) alert {
+	labels := map[string]string{
+		"alertname": alertName,
+		"issue":     issue.id(),
+		"check":     string(issue.kind),
+		"severity":  issue.issueType.String(),
+	}
+	if issue.target != "" {
+		labels["target"] = issue.target
+	}
+	return alert{
+		Labels:      labels,
+		Annotations: map[string]string{"summary": issue.message},
+		StartsAt:    issue.firstSeen,
+		EndsAt:      endsAt,
+	}
+}
+
+// newAlerts returns the alerts to send after a cycle: the confirmed issues,
+// which are re-sent every cycle and stay active for ttl unless sent again, and
+// the fixed issues, which end now. The ttl should span a few cycles, so that
+// a slow cycle does not make Alertmanager resolve an alert by itself.
+//
+// The severity is a label, so an issue whose severity changed since the
+// previous cycle, prev, is a new alert; the alert of its old severity ends now.
+func newAlerts(prev, confirmed, fixed issueEntries, now time.Time, ttl time.Duration) []alert {
+	prevByID := make(map[string]issueEntry, len(prev))
+	for _, issue := range prev {
+		prevByID[issue.id()] = issue
+	}
+	alerts := make([]alert, 0, len(confirmed)+len(fixed))
+	for _, issue := range confirmed {
+		if old, ok := prevByID[issue.id()]; ok && old.issueType != issue.issueType {
+			alerts = append(alerts, newAlert(old, now))
+		}
+		alerts = append(alerts, newAlert(issue, now.Add(ttl)))
+	}
+	for _, issue := range fixed {
+		alerts = append(alerts, newAlert(issue, now))
+	}
+	return alerts
+}
+
+func pushToAlertmanagers(c Conf, alerts []alert) {
+	if len(alerts) == 0 {
+		return
+	}
+	body, err := json.Marshal(alerts)
+	if err != nil {
+		log.Printf("Alertmanager: %s", err)
+		return
+	}
+	for _, u := range c.Alertmanagers {
+		// A failing Alertmanager must not hold up the others; the next cycle
+		// sends the active alerts again anyway.
+		recordNotification("alertmanager", sendToAlertmanager(u, body))
+	}
+}
+
+func sendToAlertmanager(baseURL string, body []byte) bool {
+	u := strings.TrimSuffix(baseURL, "/") + "/api/v2/alerts"
+	res, err := webHookClient.Post(u, "application/json", bytes.NewReader(body))
+	if err != nil {
+		log.Printf("Alertmanager %s: %s", redactURL(u), redactErr(err, u))
+		return false
+	}
+	defer res.Body.Close()
+	resBody, _ := io.ReadAll(res.Body)
+	if res.StatusCode != http.StatusOK {
+		log.Printf("Alertmanager %s: unexpected status %s: %s", redactURL(u), res.Status, truncateForLog(string(resBody)))
+		return false
+	}
+	return true
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestPushToAlertmanagersSendsActiveAndResolvedAlerts(t *testing.T) {
+	var (
+		mu     sync.Mutex
+		path   string
+		alerts []alert
+	)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		path = r.URL.Path
+		if err := json.NewDecoder(r.Body).Decode(&alerts); err != nil {
+			t.Errorf("decode alerts: %s", err)
+		}
+	}))
+	defer srv.Close()
+
+	oldConf := conf
+	defer func() { conf = oldConf }()
+	conf = Conf{Alertmanagers: []string{srv.URL + "/"}}
+
+	now := time.Now().Truncate(time.Second)
+	down := issueEntry{issueType: danger, message: "down", kind: kindHealthCheck, target: "https://yivi.app", condition: "unreachable", firstSeen: now.Add(-time.Hour)}
+	expiring := issueEntry{issueType: warning, message: "expiring", kind: kindCertificate, target: "https://yivi.app", condition: "expiring:3f", firstSeen: now.Add(-time.Hour)}
+	pushToAlertmanagers(conf, newAlerts(nil, issueEntries{down}, issueEntries{expiring}, now, 15*time.Minute))
+
+	mu.Lock()
+	defer mu.Unlock()
+	if path != "/api/v2/alerts" {
+		t.Errorf("posted to %s, want /api/v2/alerts", path)
+	}
+	if len(alerts) != 2 {
+		t.Fatalf("expected 2 alerts, got %+v", alerts)
+	}
+	active, resolved := alerts[0], alerts[1]
+	if active.Labels["severity"] != "danger" || active.Labels["check"] != "healthcheck" || active.Labels["target"] != "https://yivi.app" {
+		t.Errorf("unexpected labels %v", active.Labels)
+	}
+	if !active.StartsAt.Equal(down.firstSeen) || !active.EndsAt.Equal(now.Add(15*time.Minute)) {
+		t.Errorf("active alert runs %s - %s, want %s - %s", active.StartsAt, active.EndsAt, down.firstSeen, now.Add(15*time.Minute))
+	}
+	if resolved.Labels["issue"] != expiring.id() || !resolved.EndsAt.Equal(now) {
+		t.Errorf("expected %s to be resolved now, got %+v", expiring.id(), resolved)
+	}
+}
+
+// TestNewAlertsResolvesAlertOfOldSeverity: when an issue escalates, the alert
+// of its old severity is resolved rather than left to expire.
+func TestNewAlertsResolvesAlertOfOldSeverity(t *testing.T) {
+	now := time.Now().Truncate(time.Second)
+	slow := issueEntry{issueType: warning, message: "slow", kind: kindHealthCheck, target: "https://yivi.app", condition: "slow", firstSeen: now.Add(-time.Hour)}
+	slower := slow
+	slower.issueType = danger
+
+	alerts := newAlerts(issueEntries{slow}, issueEntries{slower}, nil, now, 15*time.Minute)
+	if len(alerts) != 2 {
+		t.Fatalf("expected the old alert to be resolved and the new one raised, got %+v", alerts)
+	}
+	resolved, active := alerts[0], alerts[1]
+	if resolved.Labels["severity"] != "warning" || !resolved.EndsAt.Equal(now) {
+		t.Errorf("expected the warning to be resolved now, got %+v", resolved)
+	}
+	if active.Labels["severity"] != "danger" || !active.EndsAt.Equal(now.Add(15*time.Minute)) {
+		t.Errorf("expected an active danger, got %+v", active)
+	}
+
+	if alerts := newAlerts(issueEntries{slower}, issueEntries{slower}, nil, now, 15*time.Minute); len(alerts) != 1 {
+		t.Errorf("expected only the active alert while the severity stays the same, got %+v", alerts)
+	}
+}
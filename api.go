@@ -0,0 +1,64 @@
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"time"
+)
+
+// apiIssue is the JSON representation of a confirmed issue.
+type apiIssue struct {
+	ID        string    `json:"id"`
+	Severity  string    `json:"severity"`
+	Message   string    `json:"message"`
+	Check     checkKind `json:"check"`
+	Target    string    `json:"target,omitempty"`
+	FirstSeen time.Time `json:"first_seen,omitzero"`
+	LastSeen  time.Time `json:"last_seen,omitzero"`
+}
+
+// apiStatus is the response body of /api/v1/status.
+type apiStatus struct {
+	Issues          []apiIssue `json:"issues"`
+	LastCheck       time.Time  `json:"last_check,omitzero"` // zero until the first cycle completed
+	IntervalSeconds int        `json:"interval_seconds"`
+}
+
+func newAPIIssue(issue issueEntry) apiIssue {
+	return apiIssue{
+		ID:        issue.id(),
+		Severity:  issue.issueType.String(),
+		Message:   issue.message,
+		Check:     issue.kind,
+		Target:    issue.target,
+		FirstSeen: issue.firstSeen,
+		LastSeen:  issue.lastSeen,
+	}
+}
+
+func newAPIIssues(il issueEntries) []apiIssue {
+	ret := make([]apiIssue, 0, len(il))
+	for _, issue := range il {
+		ret = append(ret, newAPIIssue(issue))
+	}
+	return ret
+}
+
+// Handle /api/v1/status HTTP request: the same information as the HTML
+// dashboard, but in a form that tooling can consume.
+func statusHandler(w http.ResponseWriter, r *http.Request) {
+	curIssues, when := currentState()
+	writeJSON(w, apiStatus{
+		Issues:          newAPIIssues(curIssues),
+		LastCheck:       when,
+		IntervalSeconds: int(currentConf().Interval.Seconds()),
+	})
+}
+
+func writeJSON(w http.ResponseWriter, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		log.Printf("Error encoding JSON response: %s", err)
+	}
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestStatusHandlerReturnsConfirmedIssues(t *testing.T) {
+	oldConf := conf
+	defer func() { conf = oldConf }()
+	conf.Interval = 5 * time.Minute
+
+	firstSeen := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	lastSeen := firstSeen.Add(10 * time.Minute)
+	when := lastSeen.Add(time.Second)
+	setState(issueEntries{{
+		issueType: danger,
+		message:   "https://yivi.app: cannot be reached",
+		kind:      kindHealthCheck,
+		target:    "https://yivi.app",
+		firstSeen: firstSeen,
+		lastSeen:  lastSeen,
+	}}, when)
+	defer setState(nil, time.Time{})
+
+	rec := httptest.NewRecorder()
+	statusHandler(rec, httptest.NewRequest(http.MethodGet, "/api/v1/status", nil))
+
+	if ct := rec.Header().Get("Content-Type"); ct != "application/json" {
+		t.Errorf("Content-Type = %q, want application/json", ct)
+	}
+	var got apiStatus
+	if err := json.NewDecoder(rec.Body).Decode(&got); err != nil {
+		t.Fatalf("decode response: %s", err)
+	}
+	if got.IntervalSeconds != 300 {
+		t.Errorf("interval_seconds = %d, want 300", got.IntervalSeconds)
+	}
+	if !got.LastCheck.Equal(when) {
+		t.Errorf("last_check = %s, want %s", got.LastCheck, when)
+	}
+	if len(got.Issues) != 1 {
+		t.Fatalf("expected 1 issue, got %v", got.Issues)
+	}
+	want := apiIssue{
+		Severity:  "danger",
+		Message:   "https://yivi.app: cannot be reached",
+		Check:     kindHealthCheck,
+		Target:    "https://yivi.app",
+		FirstSeen: firstSeen,
+		LastSeen:  lastSeen,
+	}
+	if i := got.Issues[0]; i.Severity != want.Severity || i.Message != want.Message || i.Check != want.Check ||
+		i.Target != want.Target || !i.FirstSeen.Equal(want.FirstSeen) || !i.LastSeen.Equal(want.LastSeen) {
+		t.Errorf("issue = %+v, want %+v", i, want)
+	}
+}
+
+// TestStatusHandlerEmptyIssuesIsArray: consumers should be able to iterate the
+// issues without special-casing null.
+func TestStatusHandlerEmptyIssuesIsArray(t *testing.T) {
+	setState(nil, time.Time{})
+
+	rec := httptest.NewRecorder()
+	statusHandler(rec, httptest.NewRequest(http.MethodGet, "/api/v1/status", nil))
+
+	var raw map[string]json.RawMessage
+	if err := json.NewDecoder(rec.Body).Decode(&raw); err != nil {
+		t.Fatalf("decode response: %s", err)
+	}
+	if string(raw["issues"]) != "[]" {
+		t.Errorf("issues = %s, want []", raw["issues"])
+	}
+	if _, ok := raw["last_check"]; ok {
+		t.Errorf("last_check should be omitted before the first cycle, got %s", raw["last_check"])
+	}
+}
+
+// TestConfirmIssuesTracksFirstAndLastSeen: firstSeen is the start of the
+// streak, not the moment of confirmation, and survives refreshes.
+func TestConfirmIssuesTracksFirstAndLastSeen(t *testing.T) {
+	resetDebounceState(2)
+
+	msg := "yivi.app: cannot be reached"
+	confirmIssues(issueEntries{issue(msg)})
+	detected := pendingSet[msg].firstSeen
+	if detected.IsZero() {
+		t.Fatalf("expected firstSeen to be recorded on first detection")
+	}
+
+	confirmed := confirmIssues(issueEntries{issue(msg)})
+	if len(confirmed) != 1 || !confirmed[0].firstSeen.Equal(detected) {
+		t.Fatalf("expected firstSeen %s on confirmation, got %v", detected, confirmed)
+	}
+	confirmedAt := confirmed[0].lastSeen
+
+	refreshed := confirmIssues(issueEntries{issue(msg)})
+	if !refreshed[0].firstSeen.Equal(detected) {
+		t.Errorf("firstSeen changed on refresh: %s, want %s", refreshed[0].firstSeen, detected)
+	}
+	if refreshed[0].lastSeen.Before(confirmedAt) {
+		t.Errorf("lastSeen went backwards: %s < %s", refreshed[0].lastSeen, confirmedAt)
+	}
+}
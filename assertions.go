@@ -0,0 +1,212 @@
+package main
+
+import (
+	"cmp"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// jsonAssertion is an assertion on a value in a JSON response body, such as
+//
+//	$.status == "ok"
+//	$.version >= 0.14
+//	/servers/0/healthy == true
+//	$.keyshare
+//
+// The path is either a JSONPath of names and indices ($.a.b[0]["c"]) or a
+// JSON pointer (/a/b/0/c). Without an operator the value only has to exist.
+// Values are JSON literals; ordering compares numbers, and strings that look
+// like versions (0.14.2) component by component.
+type jsonAssertion struct {
+	raw  string
+	path []string
+	op   string
+	want any
+	// wantRaw is the value as written, as 0.14 is not the same version as 0.140.
+	wantRaw string
+}
+
+var jsonAssertionPattern = regexp.MustCompile(`^\s*([^=!<>\s]+)\s*(?:(==|!=|>=|<=|>|<)\s*(.+?))?\s*$`)
+
+func parseJSONAssertion(raw string) (a jsonAssertion, err error) {
+	m := jsonAssertionPattern.FindStringSubmatch(raw)
+	if m == nil {
+		return a, fmt.Errorf("invalid JSON assertion %q", raw)
+	}
+	a.raw, a.op, a.wantRaw = raw, m[2], m[3]
+	if a.path, err = parseJSONPath(m[1]); err != nil {
+		return a, fmt.Errorf("invalid JSON assertion %q: %w", raw, err)
+	}
+	if a.op != "" {
+		if err = json.Unmarshal([]byte(a.wantRaw), &a.want); err != nil {
+			return a, fmt.Errorf("invalid JSON assertion %q: value is not a JSON literal: %w", raw, err)
+		}
+	}
+	return a, nil
+}
+
+// parseJSONPath splits a JSONPath or JSON pointer into its segments.
+func parseJSONPath(path string) ([]string, error) {
+	if strings.HasPrefix(path, "/") {
+		segments := strings.Split(path[1:], "/")
+		for i, s := range segments {
+			segments[i] = strings.NewReplacer("~1", "/", "~0", "~").Replace(s)
+		}
+		return segments, nil
+	}
+	if !strings.HasPrefix(path, "$") {
+		return nil, fmt.Errorf("path %q must start with $ or /", path)
+	}
+	var segments []string
+	rest := path[1:]
+	for rest != "" {
+		switch {
+		case rest[0] == '.':
+			end := strings.IndexAny(rest[1:], ".[")
+			if end < 0 {
+				end = len(rest) - 1
+			}
+			if end == 0 {
+				return nil, fmt.Errorf("empty name in path %q", path)
+			}
+			segments = append(segments, rest[1:end+1])
+			rest = rest[end+1:]
+		case rest[0] == '[':
+			end := strings.IndexByte(rest, ']')
+			if end < 0 {
+				return nil, fmt.Errorf("unterminated [ in path %q", path)
+			}
+			segment := rest[1:end]
+			if unquoted, err := strconv.Unquote(segment); err == nil {
+				segment = unquoted
+			} else if _, err := strconv.Atoi(segment); err != nil {
+				return nil, fmt.Errorf("invalid index %s in path %q", segment, path)
+			}
+			segments = append(segments, segment)
+			rest = rest[end+1:]
+		default:
+			return nil, fmt.Errorf("unexpected %q in path %q", rest[0], path)
+		}
+	}
+	return segments, nil
+}
+
+// lookup returns the value at path in doc, if there is one.
+func lookup(doc any, path []string) (any, bool) {
+	for _, segment := range path {
+		switch v := doc.(type) {
+		case map[string]any:
+			var ok bool
+			if doc, ok = v[segment]; !ok {
+				return nil, false
+			}
+		case []any:
+			i, err := strconv.Atoi(segment)
+			if err != nil || i < 0 || i >= len(v) {
+				return nil, false
+			}
+			doc = v[i]
+		default:
+			return nil, false
+		}
+	}
+	return doc, true
+}
+
+// check returns nil if the assertion holds for doc, and otherwise what is
+// wrong.
+func (a jsonAssertion) check(doc any) error {
+	got, ok := lookup(doc, a.path)
+	if !ok {
+		return fmt.Errorf("%s: not found", a.raw)
+	}
+	if a.op == "" {
+		return nil
+	}
+	gotRaw, _ := json.Marshal(got)
+
+	var holds bool
+	switch a.op {
+	case "==":
+		holds = reflect.DeepEqual(got, a.want)
+	case "!=":
+		holds = !reflect.DeepEqual(got, a.want)
+	default:
+		c, comparable := compareJSON(got, a.want, a.wantRaw)
+		if !comparable {
+			return fmt.Errorf("%s: cannot compare %s", a.raw, gotRaw)
+		}
+		switch a.op {
+		case ">=":
+			holds = c >= 0
+		case "<=":
+			holds = c <= 0
+		case ">":
+			holds = c > 0
+		case "<":
+			holds = c < 0
+		}
+	}
+	if !holds {
+		return fmt.Errorf("%s: got %s", a.raw, gotRaw)
+	}
+	return nil
+}
+
+// compareJSON orders got and want if they are both numbers, or both look like
+// versions.
+func compareJSON(got, want any, wantRaw string) (int, bool) {
+	if g, ok := got.(float64); ok {
+		if w, ok := want.(float64); ok {
+			return cmp.Compare(g, w), true
+		}
+		return 0, false
+	}
+	g, ok := got.(string)
+	if !ok {
+		return 0, false
+	}
+	if w, ok := want.(string); ok {
+		wantRaw = w
+	}
+	return compareVersions(g, wantRaw)
+}
+
+// compareVersions compares dotted versions such as 0.14.2 numerically, with a
+// missing component counting as zero. A leading v is ignored.
+func compareVersions(a, b string) (int, bool) {
+	parse := func(s string) ([]int, bool) {
+		parts := strings.Split(strings.TrimPrefix(s, "v"), ".")
+		ret := make([]int, len(parts))
+		for i, p := range parts {
+			n, err := strconv.Atoi(p)
+			if err != nil {
+				return nil, false
+			}
+			ret[i] = n
+		}
+		return ret, true
+	}
+	va, okA := parse(a)
+	vb, okB := parse(b)
+	if !okA || !okB {
+		return 0, false
+	}
+	for i := 0; i < max(len(va), len(vb)); i++ {
+		var x, y int
+		if i < len(va) {
+			x = va[i]
+		}
+		if i < len(vb) {
+			y = vb[i]
+		}
+		if c := cmp.Compare(x, y); c != 0 {
+			return c, true
+		}
+	}
+	return 0, true
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestJSONAssertions(t *testing.T) {
+	var doc any
+	body := `{"status": "ok", "version": "0.14.2", "servers": [{"healthy": true}, {"healthy": false}], "load": 0.5, "a/b": 1}`
+	if err := json.Unmarshal([]byte(body), &doc); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tc := range []struct {
+		assertion string
+		holds     bool
+	}{
+		{`$.status == "ok"`, true},
+		{`$.status != "ok"`, false},
+		{`$.version >= 0.14`, true},
+		{`$.version >= "0.15"`, false},
+		{`$.version < 1`, true},
+		{`$.servers[0].healthy == true`, true},
+		{`$.servers[1]["healthy"] == true`, false},
+		{`/servers/1/healthy == false`, true},
+		{`/a~1b == 1`, true},
+		{`$.load <= 0.75`, true},
+		{`$.load > 1`, false},
+		{`$.status`, true},
+		{`$.missing`, false},
+		{`$.servers[5]`, false},
+		{`$.status > 1`, false}, // not comparable
+	} {
+		a, err := parseJSONAssertion(tc.assertion)
+		if err != nil {
+			t.Errorf("%s: %s", tc.assertion, err)
+			continue
+		}
+		if err := a.check(doc); (err == nil) != tc.holds {
+			t.Errorf("%s: holds = %t, want %t (%v)", tc.assertion, err == nil, tc.holds, err)
+		}
+	}
+}
+
+func TestParseJSONAssertionRejectsInvalid(t *testing.T) {
+	for _, raw := range []string{`status == "ok"`, `$.status == ok`, `$.servers[x]`, `$..status`, `$.status ==`} {
+		if _, err := parseJSONAssertion(raw); err == nil {
+			t.Errorf("expected %q to be rejected", raw)
+		}
+	}
+}
@@ -0,0 +1,258 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+	"sync"
+
+	irma "github.com/privacybydesign/irmago"
+)
+
+// checkTarget identifies a single configured check.
+type checkTarget struct {
+	kind   checkKind
+	target string
+}
+
+// label names the check in messages: its target, or its kind for checks that
+// don't have a single target.
+func (c checkTarget) label() string {
+	if c.target != "" {
+		return c.target
+	}
+	return string(c.kind)
+}
+
+// key identifies the check in the state file.
+func (c checkTarget) key() string {
+	return string(c.kind) + "|" + c.target
+}
+
+func parseCheckTarget(key string) checkTarget {
+	kind, target, _ := strings.Cut(key, "|")
+	return checkTarget{checkKind(kind), target}
+}
+
+// checkJob is a single unit of work of a check cycle: one target of one kind
+// of check. Jobs don't depend on each other, so runCheckJobs is free to run
+// them in parallel.
+type checkJob struct {
+	checkTarget
+	schedule Schedule // with the global defaults filled in
+	run      func(ctx context.Context) issueEntries
+}
+
+// checkJobs lists the jobs of one cycle for the current configuration. The
+// jobs can outlive their cycle, and the configuration with it, so they must
+// not read conf when they run.
+func checkJobs(irmaConfig *irma.Configuration) (jobs []checkJob) {
+	// Re-use the same connection pool for all checks to prevent false positives
+	// due to DNS resolution, TLS handshake issues or connection starvation.
+	client := newHTTPClient()
+
+	for _, url := range slices.Sorted(maps.Keys(conf.CheckSchemeManagers)) {
+		keyExpiry := conf.CheckSchemeManagers[url].KeyExpiry.orDefault(conf.KeyExpiry)
+		jobs = append(jobs, checkJob{
+			checkTarget: checkTarget{kindSchemeManager, url},
+			schedule:    conf.CheckSchemeManagers[url].orDefault(),
+			run: func(ctx context.Context) issueEntries {
+				return checkSchemeManager(ctx, irmaConfig, url, keyExpiry)
+			},
+		})
+	}
+	for _, check := range conf.CheckCertificateExpiry {
+		horizons := check.Expiry.orDefault(conf.CertificateExpiry)
+		jobs = append(jobs, checkJob{
+			checkTarget: checkTarget{kindCertificate, check.URL},
+			schedule:    check.orDefault(),
+			run: func(ctx context.Context) issueEntries {
+				return checkCertificateExpiryOf(ctx, client, check.URL, horizons)
+			},
+		})
+	}
+	for _, check := range conf.CheckTLS {
+		jobs = append(jobs, checkJob{
+			checkTarget: checkTarget{kindTLS, check.URL},
+			schedule:    check.orDefault(),
+			run: func(ctx context.Context) issueEntries {
+				return checkTLS(ctx, check.URL, nil)
+			},
+		})
+	}
+	ct := conf.CheckCT
+	for _, domain := range ct.Domains {
+		jobs = append(jobs, checkJob{
+			checkTarget: checkTarget{kindCT, domain},
+			schedule:    ct.orDefault(),
+			run: func(ctx context.Context) issueEntries {
+				return checkCertificateTransparency(ctx, client, ct, domain)
+			},
+		})
+	}
+	for _, check := range conf.CheckDNS {
+		jobs = append(jobs, checkJob{
+			checkTarget: checkTarget{kindDNS, check.Name},
+			schedule:    check.orDefault(),
+			run: func(ctx context.Context) issueEntries {
+				return checkDNS(ctx, check)
+			},
+		})
+	}
+	for _, check := range conf.CheckAtumServers {
+		jobs = append(jobs, checkJob{
+			checkTarget: checkTarget{kindAtum, check.URL},
+			schedule:    check.orDefault(),
+			run: func(ctx context.Context) issueEntries {
+				return checkAtumServer(ctx, check.URL)
+			},
+		})
+	}
+	for _, check := range conf.CheckKeyshareServers {
+		jobs = append(jobs, checkJob{
+			checkTarget: checkTarget{kindKeyshare, check.Scheme},
+			schedule:    check.orDefault(),
+			run: func(ctx context.Context) issueEntries {
+				return checkKeyshareServer(ctx, client, irmaConfig, check)
+			},
+		})
+	}
+	for _, check := range conf.HealthChecks {
+		jobs = append(jobs, checkJob{
+			checkTarget: checkTarget{kindHealthCheck, check.RequestURL},
+			schedule:    check.orDefault(),
+			run: func(ctx context.Context) issueEntries {
+				if issue := runHealthCheck(ctx, client, check); issue != nil {
+					return issueEntries{*issue}
+				}
+				return nil
+			},
+		})
+	}
+	for _, check := range conf.ScriptedChecks {
+		jobs = append(jobs, checkJob{
+			checkTarget: checkTarget{kindScripted, check.Name},
+			schedule:    check.orDefault(),
+			run: func(ctx context.Context) issueEntries {
+				return runScriptedCheck(ctx, client, check)
+			},
+		})
+	}
+	for _, check := range conf.SessionChecks {
+		jobs = append(jobs, checkJob{
+			checkTarget: checkTarget{kindSession, check.URL},
+			schedule:    check.orDefault(),
+			run: func(ctx context.Context) issueEntries {
+				return runSessionCheck(ctx, check)
+			},
+		})
+	}
+	return
+}
+
+// overdue counts, per target, the jobs that are still running after the
+// deadline of their cycle. Most checks can't be interrupted, and a target is not
+// dispatched again while a job of it is overdue: otherwise jobs that hang would
+// pile up, cycle after cycle.
+var (
+	overdueMu sync.Mutex
+	overdue   = map[checkTarget]int{}
+)
+
+// runCheckJobs runs jobs with at most limit of them in flight and returns
+// their issues, tagged with the job's kind and target, in job order. A job that
+// has not finished when ctx expires is reported as an issue of its own rather
+// than holding up the cycle; whatever it returns later is discarded.
+func runCheckJobs(ctx context.Context, limit int, jobs []checkJob) (ret issueEntries) {
+	type result struct {
+		i      int
+		issues issueEntries
+	}
+	// Buffered, so that jobs finishing after the deadline don't block forever.
+	resultChan := make(chan result, len(jobs))
+	sem := make(chan struct{}, limit)
+	// Guarded by overdueMu: whether each job returned, or was given up on.
+	done := make([]bool, len(jobs))
+	late := make([]bool, len(jobs))
+	stillRunning := make([]bool, len(jobs))
+
+	go func() {
+		for i, job := range jobs {
+			overdueMu.Lock()
+			busy := overdue[job.checkTarget] > 0
+			overdueMu.Unlock()
+			if busy {
+				stillRunning[i] = true
+				resultChan <- result{i, nil}
+				continue
+			}
+			select {
+			case sem <- struct{}{}:
+			case <-ctx.Done():
+				return
+			}
+			go func() {
+				defer func() { <-sem }()
+				issues := job.run(ctx)
+				overdueMu.Lock()
+				done[i] = true
+				if late[i] {
+					overdue[job.checkTarget]--
+					if overdue[job.checkTarget] == 0 {
+						delete(overdue, job.checkTarget)
+					}
+				}
+				overdueMu.Unlock()
+				resultChan <- result{i, issues}
+			}()
+		}
+	}()
+
+	results := make([]issueEntries, len(jobs))
+	finished := make([]bool, len(jobs))
+collect:
+	for range jobs {
+		select {
+		case r := <-resultChan:
+			results[r.i] = r.issues
+			finished[r.i] = true
+		case <-ctx.Done():
+			break collect
+		}
+	}
+
+	overdueMu.Lock()
+	for i, job := range jobs {
+		if !finished[i] && !done[i] {
+			late[i] = true
+			overdue[job.checkTarget]++
+		}
+	}
+	overdueMu.Unlock()
+
+	for i, job := range jobs {
+		switch {
+		case !finished[i]:
+			ret = append(ret, issueEntry{
+				issueType: warning,
+				condition: "deadline",
+				message:   fmt.Sprintf("%s: check did not finish within the cycle deadline", job.label()),
+				kind:      job.kind,
+				target:    job.target,
+			})
+		case stillRunning[i]:
+			ret = append(ret, issueEntry{
+				issueType: warning,
+				condition: "deadline",
+				message:   fmt.Sprintf("%s: check is still running since an earlier cycle", job.label()),
+				kind:      job.kind,
+				target:    job.target,
+			})
+		default:
+			ret = append(ret, results[i].tag(job.kind, job.target)...)
+		}
+	}
+	return
+}
@@ -0,0 +1,148 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestRunCheckJobsBoundsConcurrency(t *testing.T) {
+	var running, maxRunning int32
+	job := func(context.Context) issueEntries {
+		n := atomic.AddInt32(&running, 1)
+		for {
+			m := atomic.LoadInt32(&maxRunning)
+			if n <= m || atomic.CompareAndSwapInt32(&maxRunning, m, n) {
+				break
+			}
+		}
+		time.Sleep(20 * time.Millisecond)
+		atomic.AddInt32(&running, -1)
+		return nil
+	}
+
+	var jobs []checkJob
+	for i := 0; i < 10; i++ {
+		jobs = append(jobs, checkJob{checkTarget: checkTarget{kindHealthCheck, "https://yivi.app"}, run: job})
+	}
+	runCheckJobs(context.Background(), 3, jobs)
+
+	if got := atomic.LoadInt32(&maxRunning); got != 3 {
+		t.Errorf("expected at most (and, with 10 jobs, exactly) 3 jobs in flight, got %d", got)
+	}
+}
+
+// TestRunCheckJobsRunsInParallel: ten jobs of 50ms with enough workers must not
+// take anywhere near the 500ms a serial cycle would.
+func TestRunCheckJobsRunsInParallel(t *testing.T) {
+	var jobs []checkJob
+	for i := 0; i < 10; i++ {
+		jobs = append(jobs, checkJob{checkTarget: checkTarget{kindAtum, "https://atum.example"}, run: func(context.Context) issueEntries {
+			time.Sleep(50 * time.Millisecond)
+			return nil
+		}})
+	}
+
+	start := time.Now()
+	runCheckJobs(context.Background(), 10, jobs)
+	if elapsed := time.Since(start); elapsed > 250*time.Millisecond {
+		t.Errorf("jobs did not run in parallel, took %s", elapsed)
+	}
+}
+
+func TestRunCheckJobsTagsAndKeepsOrder(t *testing.T) {
+	jobs := []checkJob{
+		{checkTarget: checkTarget{kindCertificate, "https://a.example"}, run: func(context.Context) issueEntries {
+			time.Sleep(20 * time.Millisecond) // finishes last
+			return issueEntries{{issueType: warning, message: "a"}}
+		}},
+		{checkTarget: checkTarget{kindHealthCheck, "https://b.example"}, run: func(context.Context) issueEntries {
+			return issueEntries{{issueType: danger, message: "b"}}
+		}},
+	}
+
+	got := runCheckJobs(context.Background(), 2, jobs)
+	if len(got) != 2 || got[0].message != "a" || got[1].message != "b" {
+		t.Fatalf("expected issues in job order [a b], got %v", got.messages())
+	}
+	if got[0].kind != kindCertificate || got[0].target != "https://a.example" {
+		t.Errorf("issue a not tagged with its job: %+v", got[0])
+	}
+	if got[1].kind != kindHealthCheck || got[1].target != "https://b.example" {
+		t.Errorf("issue b not tagged with its job: %+v", got[1])
+	}
+}
+
+// TestRunCheckJobsReportsJobsPastDeadline: a hung check must not hold up the
+// cycle, and must not go unnoticed either.
+func TestRunCheckJobsReportsJobsPastDeadline(t *testing.T) {
+	block := make(chan struct{})
+	defer close(block)
+
+	jobs := []checkJob{
+		{checkTarget: checkTarget{kindAtum, "https://hung.example"}, run: func(context.Context) issueEntries {
+			<-block // ignores its context, like atum.JsonStamp
+			return nil
+		}},
+		{checkTarget: checkTarget{kindAtum, "https://fine.example"}, run: func(context.Context) issueEntries {
+			return nil
+		}},
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	got := runCheckJobs(ctx, 2, jobs)
+
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("runCheckJobs waited for the hung job, took %s", elapsed)
+	}
+	if len(got) != 1 || got[0].target != "https://hung.example" || !strings.Contains(got[0].message, "did not finish") {
+		t.Fatalf("expected only the hung job to be reported, got %v", got.messages())
+	}
+}
+
+// TestRunCheckJobsSkipsOverdueTargets: a job that outlived its cycle is not
+// dispatched again until it returns, so hung jobs don't pile up.
+func TestRunCheckJobsSkipsOverdueTargets(t *testing.T) {
+	block := make(chan struct{})
+	started := make(chan struct{}, 2)
+	var runs atomic.Int32
+	jobs := []checkJob{{checkTarget: checkTarget{kindAtum, "https://overdue.example"}, run: func(context.Context) issueEntries {
+		runs.Add(1)
+		started <- struct{}{}
+		<-block
+		return nil
+	}}}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	runCheckJobs(ctx, 1, jobs)
+	<-started
+
+	got := runCheckJobs(context.Background(), 1, jobs)
+	if len(got) != 1 || got[0].condition != "deadline" || !strings.Contains(got[0].message, "still running") {
+		t.Fatalf("expected the overdue job to be reported, got %v", got.messages())
+	}
+	if n := runs.Load(); n != 1 {
+		t.Errorf("expected the overdue job not to be dispatched again, ran %d times", n)
+	}
+
+	close(block)
+	for deadline := time.Now().Add(time.Second); ; time.Sleep(5 * time.Millisecond) {
+		overdueMu.Lock()
+		n := overdue[jobs[0].checkTarget]
+		overdueMu.Unlock()
+		if n == 0 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("overdue job was not released after it returned")
+		}
+	}
+	if got := runCheckJobs(context.Background(), 1, jobs); len(got) != 0 || runs.Load() != 2 {
+		t.Errorf("expected the job to run again once it returned, got %v", got.messages())
+	}
+}
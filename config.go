@@ -0,0 +1,405 @@
+package main
+
+import (
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"log"
+	"net/url"
+	"os"
+	"os/signal"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	irma "github.com/privacybydesign/irmago"
+	"gopkg.in/yaml.v3"
+)
+
+// configPollInterval is how often the configuration file is checked for
+// changes. Kubernetes updates a mounted ConfigMap without signalling the pod,
+// so SIGHUP alone is not enough.
+const configPollInterval = 30 * time.Second
+
+// confMu guards conf against the HTTP handlers while a reload swaps it. The
+// check goroutine is the only writer, so it may read conf without locking;
+// anything it starts gets a copy (see checkJobs and the notifiers) rather
+// than reading conf itself.
+var confMu sync.RWMutex
+
+// currentConf returns the configuration for use outside the check goroutine.
+func currentConf() Conf {
+	confMu.RLock()
+	defer confMu.RUnlock()
+	return conf
+}
+
+// loadConf reads the configuration file at path, applies defaults for the
+// options it leaves out, and validates the result.
+func loadConf(path string) (Conf, error) {
+	// set configuration defaults
+	c := Conf{
+		BindAddr:         ":8080",
+		Interval:         5 * time.Minute,
+		FailureThreshold: 3,
+		Concurrency:      8,
+		// The horizons of the time when these were hardcoded.
+		CertificateExpiry: ExpiryHorizons{Warning: 30},
+		KeyExpiry:         ExpiryHorizons{Warning: 31},
+	}
+
+	buf, err := os.ReadFile(path)
+	if err != nil {
+		return c, err
+	}
+	if err := yaml.Unmarshal(buf, &c); err != nil {
+		return c, err
+	}
+
+	// Threshold 1 reproduces the old alert-immediately behaviour; lower is meaningless.
+	if c.FailureThreshold < 1 {
+		c.FailureThreshold = 1
+	}
+	if c.Concurrency < 1 {
+		c.Concurrency = 1
+	}
+
+	return c, validateConf(c)
+}
+
+// validateConf catches the mistakes that would otherwise only surface as
+// confusing issues (or not at all) once the checks run.
+func validateConf(c Conf) error {
+	var errs []error
+	if c.Interval <= 0 {
+		errs = append(errs, fmt.Errorf("interval must be positive, got %s", c.Interval))
+	}
+	errs = append(errs, validateExpiryHorizons("certificateexpiry", c.CertificateExpiry))
+	errs = append(errs, validateExpiryHorizons("keyexpiry", c.KeyExpiry))
+	for u, check := range c.CheckSchemeManagers {
+		errs = append(errs, validateURL("checkschememanagers", u))
+		errs = append(errs, validateSchedule("checkschememanagers", u, check.Schedule))
+		errs = append(errs, validateExpiryHorizons("checkschememanagers: "+u, check.KeyExpiry))
+		if block, _ := pem.Decode([]byte(check.PublicKey)); block == nil {
+			errs = append(errs, fmt.Errorf("checkschememanagers: %s: public key is not PEM encoded", u))
+		}
+	}
+	for _, check := range c.CheckCertificateExpiry {
+		errs = append(errs, validateURL("checkcertificateexpiry", check.URL))
+		if !strings.HasPrefix(check.URL, "http://") {
+			errs = append(errs, validateTLSTarget("checkcertificateexpiry", check.URL))
+		}
+		errs = append(errs, validateSchedule("checkcertificateexpiry", check.URL, check.Schedule))
+		errs = append(errs, validateExpiryHorizons("checkcertificateexpiry: "+check.URL, check.Expiry))
+	}
+	for _, check := range c.CheckTLS {
+		errs = append(errs, validateTLSTarget("checktls", check.URL))
+		errs = append(errs, validateSchedule("checktls", check.URL, check.Schedule))
+	}
+	errs = append(errs, validateCertificateTransparency(c.CheckCT))
+	dnsNames := map[string]bool{}
+	for _, check := range c.CheckDNS {
+		if dnsNames[check.Name] {
+			errs = append(errs, fmt.Errorf("checkdns: duplicate name %q", check.Name))
+		}
+		dnsNames[check.Name] = true
+		errs = append(errs, validateDNSCheck(check))
+	}
+	for _, check := range c.CheckAtumServers {
+		errs = append(errs, validateURL("checkatumservers", check.URL))
+		errs = append(errs, validateSchedule("checkatumservers", check.URL, check.Schedule))
+	}
+	for _, check := range c.CheckKeyshareServers {
+		if check.Scheme == "" || strings.Contains(check.Scheme, ".") {
+			errs = append(errs, fmt.Errorf("checkkeyshareservers: %q is not a scheme identifier", check.Scheme))
+		}
+		errs = append(errs, validateSchedule("checkkeyshareservers", check.Scheme, check.Schedule))
+		if check.PublicKey != "" {
+			errs = append(errs, validateURL("checkkeyshareservers", check.PublicKey))
+		}
+	}
+	for _, check := range c.HealthChecks {
+		errs = append(errs, validateURL("healthchecks", check.RequestURL))
+		errs = append(errs, validateSchedule("healthchecks", check.RequestURL, check.Schedule))
+		errs = append(errs, validateHealthCheck(check))
+	}
+	names := map[string]bool{}
+	for _, check := range c.ScriptedChecks {
+		if names[check.Name] {
+			errs = append(errs, fmt.Errorf("scriptedchecks: duplicate name %q", check.Name))
+		}
+		names[check.Name] = true
+		errs = append(errs, validateScriptedCheck(check))
+	}
+	for _, check := range c.SessionChecks {
+		errs = append(errs, validateSessionCheck(check))
+	}
+	for _, hook := range c.JSONWebHooks {
+		errs = append(errs, validateJSONWebHook(hook))
+	}
+	if c.HistoryLimit < 0 {
+		errs = append(errs, fmt.Errorf("historylimit must not be negative, got %d", c.HistoryLimit))
+	}
+	for _, u := range c.Alertmanagers {
+		errs = append(errs, validateURL("alertmanagers", u))
+	}
+	return errors.Join(errs...)
+}
+
+// validateSchedule rejects negative overrides; zero means the global default.
+func validateSchedule(section, target string, s Schedule) error {
+	if s.Interval < 0 {
+		return fmt.Errorf("%s: %s: interval must be positive, got %s", section, target, s.Interval)
+	}
+	if s.FailureThreshold < 0 {
+		return fmt.Errorf("%s: %s: failurethreshold must be positive, got %d", section, target, s.FailureThreshold)
+	}
+	return nil
+}
+
+// validateTLSTarget checks that raw is a target that dialTLS can handle.
+func validateTLSTarget(section, raw string) error {
+	if _, _, err := tlsAddress(raw); err != nil {
+		return fmt.Errorf("%s: %s: %w", section, raw, err)
+	}
+	return nil
+}
+
+func validateURL(section, raw string) error {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return fmt.Errorf("%s: %w", section, err)
+	}
+	if u.Scheme == "" || u.Host == "" {
+		return fmt.Errorf("%s: %q is not an absolute URL", section, raw)
+	}
+	return nil
+}
+
+// watchConfig returns a channel that receives a value whenever the
+// configuration at path should be reloaded: on SIGHUP, and when the
+// modification time of the file changes.
+func watchConfig(path string) <-chan struct{} {
+	reload := make(chan struct{}, 1)
+	trigger := func() {
+		select {
+		case reload <- struct{}{}:
+		default: // a reload is already pending
+		}
+	}
+
+	sighup := make(chan os.Signal, 1)
+	signal.Notify(sighup, syscall.SIGHUP)
+	go func() {
+		for range sighup {
+			log.Printf("Received SIGHUP, reloading %s", path)
+			trigger()
+		}
+	}()
+
+	go func() {
+		modTime := fileModTime(path)
+		for range time.Tick(configPollInterval) {
+			if m := fileModTime(path); !m.Equal(modTime) {
+				log.Printf("%s changed, reloading", path)
+				modTime = m
+				trigger()
+			}
+		}
+	}()
+
+	return reload
+}
+
+func fileModTime(path string) time.Time {
+	fi, err := os.Stat(path)
+	if err != nil {
+		return time.Time{}
+	}
+	return fi.ModTime()
+}
+
+// reloadConf re-reads the configuration at path and applies it. An invalid
+// configuration is rejected as a whole and the running one stays in effect.
+func reloadConf(path string, irmaConfig *irma.Configuration) {
+	newConf, err := loadConf(path)
+	if err != nil {
+		log.Printf("Not reloading invalid config file %s, keeping the current configuration: %s", path, err)
+		return
+	}
+	if err := applyConf(newConf, irmaConfig); err != nil {
+		log.Printf("Could not apply config file %s, keeping the current configuration: %s", path, err)
+		return
+	}
+	log.Printf("Reloaded configuration from %s", path)
+}
+
+// applyConf makes newConf the running configuration. It must be called from
+// the check goroutine, between cycles.
+func applyConf(newConf Conf, irmaConfig *irma.Configuration) error {
+	oldTick := tickInterval(checkJobs(irmaConfig))
+	if err := updateSchemes(conf.CheckSchemeManagers, newConf.CheckSchemeManagers, irmaConfig); err != nil {
+		return err
+	}
+
+	if newConf.BindAddr != conf.BindAddr {
+		log.Printf("Ignoring changed bindaddr %s: this requires a restart", newConf.BindAddr)
+		newConf.BindAddr = conf.BindAddr
+	}
+	if newConf.Interval != conf.Interval {
+		log.Printf("Will check status every %s", newConf.Interval)
+	}
+
+	confMu.Lock()
+	conf = newConf
+	confMu.Unlock()
+
+	jobs := checkJobs(irmaConfig)
+	if tick := tickInterval(jobs); tick != oldTick {
+		ticker.Reset(tick)
+	}
+	forgetRemovedChecks(jobs)
+	return nil
+}
+
+// forgetRemovedChecks drops everything that is remembered of checks that are
+// not among jobs: after a reload, and after restoring the state of an instance
+// that ran with another configuration.
+func forgetRemovedChecks(jobs []checkJob) {
+	targets := map[checkTarget]bool{}
+	for _, job := range jobs {
+		targets[job.checkTarget] = true
+	}
+	pruneState(targets)
+	pruneUptime(targets)
+	pruneCTSeen(targets)
+}
+
+// updateSchemes installs the schemes that were added to the configuration,
+// reinstalls the ones whose public key changed and removes the ones that were
+// dropped from it. If any of that fails, what was done already is undone, so
+// that irmaConfig keeps matching the configuration that stays in effect.
+func updateSchemes(old, cur map[string]SchemeCheck, irmaConfig *irma.Configuration) (err error) {
+	schemeMu.Lock()
+	defer schemeMu.Unlock()
+
+	var undo []func() error
+	defer func() {
+		if err == nil {
+			return
+		}
+		for i := len(undo) - 1; i >= 0; i-- {
+			if uerr := undo[i](); uerr != nil {
+				log.Printf("Could not restore the schemes of the running configuration: %s", uerr)
+			}
+		}
+	}()
+	install := func(u, pk string) error {
+		log.Printf("Installing scheme %s", u)
+		if err := irmaConfig.InstallScheme(u, []byte(pk)); err != nil {
+			return fmt.Errorf("could not install scheme %s: %w", u, err)
+		}
+		undo = append(undo, func() error { return removeScheme(irmaConfig, u) })
+		return nil
+	}
+	remove := func(u, pk string) error {
+		if err := removeScheme(irmaConfig, u); err != nil {
+			return err
+		}
+		undo = append(undo, func() error { return irmaConfig.InstallScheme(u, []byte(pk)) })
+		return nil
+	}
+
+	// Installing is what fails most, so that goes first.
+	for u, check := range cur {
+		if _, ok := old[u]; !ok {
+			if err := install(u, check.PublicKey); err != nil {
+				return err
+			}
+		}
+	}
+	for u, check := range cur {
+		if prev, ok := old[u]; ok && prev.PublicKey != check.PublicKey {
+			log.Printf("Public key of scheme %s changed", u)
+			if err := remove(u, prev.PublicKey); err != nil {
+				return err
+			}
+			if err := install(u, check.PublicKey); err != nil {
+				return err
+			}
+		}
+	}
+	for u, check := range old {
+		if _, ok := cur[u]; !ok {
+			if err := remove(u, check.PublicKey); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// removeScheme removes the scheme at url, if it is installed. The caller must
+// hold schemeMu.
+func removeScheme(irmaConfig *irma.Configuration, url string) error {
+	scheme, _ := findScheme(irmaConfig, url)
+	if scheme == nil {
+		return nil
+	}
+	log.Printf("Removing scheme %s", url)
+	if err := irmaConfig.DangerousDeleteScheme(scheme); err != nil {
+		return fmt.Errorf("could not remove scheme %s: %w", url, err)
+	}
+	return nil
+}
+
+// pruneState forgets the debounce state of checks that are no longer
+// configured. Their issues would otherwise linger until the recovery threshold
+// is reached, and then be announced as fixed while nothing was fixed.
+func pruneState(targets map[checkTarget]bool) {
+	stale := func(issue issueEntry) bool {
+		return !targets[checkTarget{issue.kind, issue.target}]
+	}
+	for key, issue := range pendingSet {
+		if stale(issue) {
+			delete(pendingSet, key)
+			delete(failureStreaks, key)
+		}
+	}
+	for key, issue := range confirmedSet {
+		if stale(issue) {
+			delete(confirmedSet, key)
+			delete(failureStreaks, key)
+			delete(recoveryStreaks, key)
+		}
+	}
+	schemeSnapshotsMu.Lock()
+	for url := range schemeSnapshots {
+		if !targets[checkTarget{kindSchemeManager, url}] {
+			delete(schemeSnapshots, url)
+		}
+	}
+	schemeSnapshotsMu.Unlock()
+	for target := range lastRun {
+		if !targets[target] {
+			delete(lastRun, target)
+			delete(lastIssues, target)
+		}
+	}
+	for target := range runCounts {
+		if !targets[target] {
+			delete(runCounts, target)
+		}
+	}
+
+	// Also drop them from the published state, which the next cycle diffs against.
+	curIssues, when := currentState()
+	var kept issueEntries
+	for _, issue := range curIssues {
+		if !stale(issue) {
+			kept = append(kept, issue)
+		}
+	}
+	setState(kept, when)
+}
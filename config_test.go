@@ -0,0 +1,212 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/privacybydesign/gabi/signed"
+	irma "github.com/privacybydesign/irmago"
+)
+
+func writeConfig(t *testing.T, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoadConfAppliesDefaults(t *testing.T) {
+	c, err := loadConf(writeConfig(t, "checkatumservers: [https://keyshare.yivi.app/atumd]\n"))
+	if err != nil {
+		t.Fatalf("loadConf: %s", err)
+	}
+	if c.BindAddr != ":8080" || c.Interval != 5*time.Minute || c.FailureThreshold != 3 || c.Concurrency != 8 {
+		t.Errorf("defaults not applied: %+v", c)
+	}
+	oldConf := conf
+	defer func() { conf = oldConf }()
+	conf = c
+	if got := cycleTimeout(30 * time.Second); got != 30*time.Second {
+		t.Errorf("cycletimeout should default to the tick, got %s", got)
+	}
+}
+
+func TestLoadConfRejectsInvalidConfig(t *testing.T) {
+	for name, content := range map[string]string{
+		"unparsable":        "interval: [",
+		"negative interval": "interval: -5m\n",
+		"relative url":      "healthchecks:\n  - requesturl: yivi.app\n",
+		"scheme key":        "checkschememanagers:\n  https://schemes.yivi.app/pbdf: not a key\n",
+		"history limit":     "historylimit: -1\n",
+		"expiry order":      "certificateexpiry: {info: 7, warning: 30}\n",
+		"latency":           "healthchecks:\n  - requesturl: https://yivi.app\n    responsetime: {totalwarning: 2s, totaldanger: 1s}\n",
+		"negative latency":  "healthchecks:\n  - requesturl: https://yivi.app\n    responsetime: {ttfbdanger: -1s}\n",
+	} {
+		if _, err := loadConf(writeConfig(t, content)); err == nil {
+			t.Errorf("%s: expected loadConf to fail", name)
+		}
+	}
+}
+
+// TestApplyConfPrunesRemovedTargets: a check that is removed from the
+// configuration must not later be announced as fixed.
+func TestApplyConfPrunesRemovedTargets(t *testing.T) {
+	oldConf, oldTicker := conf, ticker
+	defer func() { conf, ticker = oldConf, oldTicker }()
+	defer setState(nil, time.Time{})
+
+	resetDebounceState(1)
+	conf.Interval = time.Minute
+	conf.HealthChecks = []HealthCheck{{RequestURL: "https://yivi.app"}, {RequestURL: "https://removed.example"}}
+	ticker = time.NewTicker(conf.Interval)
+	defer ticker.Stop()
+
+	kept := issueEntry{issueType: danger, message: "yivi.app down", kind: kindHealthCheck, target: "https://yivi.app"}
+	removed := issueEntry{issueType: danger, message: "removed down", kind: kindHealthCheck, target: "https://removed.example"}
+	setState(confirmIssues(issueEntries{kept, removed}), time.Now())
+
+	newConf := conf
+	newConf.HealthChecks = conf.HealthChecks[:1]
+	newConf.Interval = 2 * time.Minute
+	if err := applyConf(newConf, nil); err != nil {
+		t.Fatalf("applyConf: %s", err)
+	}
+
+	if _, ok := confirmedSet["removed down"]; ok {
+		t.Errorf("issue of removed check still confirmed")
+	}
+	if _, ok := confirmedSet["yivi.app down"]; !ok {
+		t.Errorf("issue of remaining check was pruned")
+	}
+	published, _ := currentState()
+	if len(published) != 1 || published[0].message != "yivi.app down" {
+		t.Errorf("published state not pruned: %v", published.messages())
+	}
+	if currentConf().Interval != 2*time.Minute {
+		t.Errorf("new configuration not applied")
+	}
+
+	// The next cycle must not report the removed check's issue as fixed.
+	_, fixed := difference(published, confirmIssues(issueEntries{kept}))
+	if len(fixed) != 0 {
+		t.Errorf("removed check reported as fixed: %v", fixed.messages())
+	}
+}
+
+func TestReloadConfKeepsRunningConfigOnError(t *testing.T) {
+	oldConf := conf
+	defer func() { conf = oldConf }()
+	conf = Conf{Interval: time.Minute, BindAddr: ":8080"}
+
+	reloadConf(writeConfig(t, "interval: 0s\nhealthchecks:\n  - requesturl: nope\n"), nil)
+
+	if conf.Interval != time.Minute || len(conf.HealthChecks) != 0 {
+		t.Errorf("invalid configuration was applied: %+v", conf)
+	}
+}
+
+func TestValidateConfReportsAllProblems(t *testing.T) {
+	err := validateConf(Conf{
+		Interval:         time.Minute,
+		CheckAtumServers: []URLCheck{{URL: "atum"}},
+		HealthChecks:     []HealthCheck{{RequestURL: "/health"}},
+	})
+	if err == nil || !strings.Contains(err.Error(), "checkatumservers") || !strings.Contains(err.Error(), "healthchecks") {
+		t.Errorf("expected both invalid URLs to be reported, got %v", err)
+	}
+}
+
+// serveTestScheme serves a minimal signed scheme over HTTPS, as irmago
+// requires, and returns its URL and public key.
+func serveTestScheme(t *testing.T, id string) (string, []byte) {
+	t.Helper()
+	dir := t.TempDir()
+	srv := httptest.NewTLSServer(http.FileServer(http.Dir(dir)))
+	t.Cleanup(srv.Close)
+	irma.SetTLSClientConfig(srv.Client().Transport.(*http.Transport).TLSClientConfig)
+	t.Cleanup(func() { irma.SetTLSClientConfig(nil) })
+
+	files := map[string]string{
+		"description.xml": fmt.Sprintf("<SchemeManager version=\"7\">\n\t<Id>%s</Id>\n\t<Url>%s/%s</Url>\n\t<Demo>true</Demo>\n\t<Name><en>%[1]s</en></Name>\n\t<Description><en>%[1]s</en></Description>\n</SchemeManager>\n", id, srv.URL, id),
+		"timestamp":       fmt.Sprintf("%d\n", time.Now().Unix()),
+	}
+	var index string
+	for _, name := range []string{"description.xml", "timestamp"} {
+		hash := sha256.Sum256([]byte(files[name]))
+		index += hex.EncodeToString(hash[:]) + " " + id + "/" + name + "\n"
+	}
+	sk, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sig, err := signed.Sign(sk, []byte(index))
+	if err != nil {
+		t.Fatal(err)
+	}
+	pk, err := signed.MarshalPemPublicKey(&sk.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	files["index"], files["index.sig"], files["pk.pem"] = index, string(sig), string(pk)
+
+	if err := os.Mkdir(filepath.Join(dir, id), 0o700); err != nil {
+		t.Fatal(err)
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(dir, id, name), []byte(content), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return srv.URL + "/" + id, pk
+}
+
+// TestUpdateSchemesRollsBack: a reload that fails halfway must leave the
+// schemes of the running configuration in place.
+func TestUpdateSchemesRollsBack(t *testing.T) {
+	url, pk := serveTestScheme(t, "test")
+	_, otherPK := serveTestScheme(t, "other")
+	irmaConfig, err := irma.NewConfiguration(t.TempDir(), irma.ConfigurationOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	running := map[string]SchemeCheck{url: {PublicKey: string(pk)}}
+	if err := updateSchemes(nil, running, irmaConfig); err != nil {
+		t.Fatalf("installing the scheme: %s", err)
+	}
+
+	// The scheme is reinstalled with the changed key, which does not verify it.
+	if err := updateSchemes(running, map[string]SchemeCheck{url: {PublicKey: string(otherPK)}}, irmaConfig); err == nil {
+		t.Errorf("expected installing with the wrong key to fail")
+	}
+	if scheme, _ := findScheme(irmaConfig, url); scheme == nil {
+		t.Fatalf("scheme was not restored after the failed reinstall")
+	}
+
+	if err := updateSchemes(running, map[string]SchemeCheck{"https://127.0.0.1:1/none": {PublicKey: string(pk)}}, irmaConfig); err == nil {
+		t.Errorf("expected installing an unreachable scheme to fail")
+	}
+	if scheme, _ := findScheme(irmaConfig, url); scheme == nil {
+		t.Fatalf("scheme was removed by a reload that failed")
+	}
+
+	if err := updateSchemes(running, nil, irmaConfig); err != nil {
+		t.Fatalf("removing the scheme: %s", err)
+	}
+	if scheme, _ := findScheme(irmaConfig, url); scheme != nil {
+		t.Errorf("scheme was not removed")
+	}
+}
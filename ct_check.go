@@ -0,0 +1,206 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"maps"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/hashicorp/go-retryablehttp"
+)
+
+// defaultCTSearchURL is the Certificate Transparency log search that is
+// queried unless the configuration names another crt.sh compatible one.
+const defaultCTSearchURL = "https://crt.sh/"
+
+// ctTimeout bounds a single search: crt.sh is slow, much slower than what we
+// allow the other checks.
+const ctTimeout = time.Minute
+
+// ctMaxValidity is how long a certificate whose expiry date cannot be parsed
+// is remembered: longer than any publicly trusted certificate is valid.
+const ctMaxValidity = 398 * 24 * time.Hour
+
+// CertificateTransparency configures the monitoring of the certificates that
+// are issued for our domains, and logged in Certificate Transparency logs.
+// Certificates of issuers that are not in Issuers are reported.
+type CertificateTransparency struct {
+	URL      string   // crt.sh compatible search API; defaults to defaultCTSearchURL
+	Domains  []string // searched including their subdomains
+	Issuers  []string // allowed issuers, matched as substrings of the issuer name
+	Schedule `yaml:",inline"`
+}
+
+// ctEntry is an entry in the crt.sh JSON output. A certificate can be listed
+// more than once, e.g. as precertificate and as certificate.
+type ctEntry struct {
+	ID           int64  `json:"id"`
+	IssuerName   string `json:"issuer_name"`
+	NameValue    string `json:"name_value"`
+	SerialNumber string `json:"serial_number"`
+	NotBefore    string `json:"not_before"`
+	NotAfter     string `json:"not_after"`
+}
+
+// ctTimeLayout is the layout of the times in the crt.sh output.
+const ctTimeLayout = "2006-01-02T15:04:05"
+
+// ctSeenCertificate is what is remembered of a certificate found in the logs.
+type ctSeenCertificate struct {
+	NotAfter time.Time
+	Baseline bool // found on the first search for the domain, and not reported
+}
+
+var (
+	// ctSeen holds the certificates found per domain, by serial number. The
+	// checks of different domains run in parallel, hence the mutex; the maps
+	// of the domains are replaced rather than modified.
+	ctMu   sync.Mutex
+	ctSeen = map[string]map[string]ctSeenCertificate{}
+)
+
+func checkCertificateTransparency(ctx context.Context, client *retryablehttp.Client, ct CertificateTransparency, domain string) (ret issueEntries) {
+	log.Printf(" checking certificate transparency logs for %s", domain)
+	entries, err := searchCTLogs(ctx, client, ct.URL, domain)
+	if err != nil {
+		return append(ret, issueEntry{issueType: warning, condition: "unreachable", message: fmt.Sprintf("%s: searching certificate transparency logs failed: %s", domain, err)})
+	}
+
+	// Work on a copy, so that saveState can serialize the map without locking.
+	ctMu.Lock()
+	seen, known := ctSeen[domain]
+	ctMu.Unlock()
+	seen = maps.Clone(seen)
+	if !known {
+		// Without history, there is no telling which certificates are new.
+		seen = map[string]ctSeenCertificate{}
+		log.Printf("Recording %d certificates for %s as the baseline", len(entries), domain)
+	}
+
+	now := time.Now()
+	reported := map[string]bool{}
+	for _, entry := range entries {
+		serial := strings.ToLower(entry.SerialNumber)
+		cert, ok := seen[serial]
+		if !ok {
+			notAfter, err := time.Parse(ctTimeLayout, entry.NotAfter)
+			if err != nil {
+				log.Printf("%s: certificate %s has an invalid expiry date: %s", domain, serial, err)
+				notAfter = now.Add(ctMaxValidity)
+			}
+			cert = ctSeenCertificate{NotAfter: notAfter, Baseline: !known}
+			seen[serial] = cert
+		}
+		if cert.Baseline || reported[serial] || ct.allows(entry.IssuerName) {
+			continue
+		}
+		reported[serial] = true
+		names := strings.ReplaceAll(entry.NameValue, "\n", ", ")
+		ret = append(ret, issueEntry{issueType: warning, condition: "unexpected:" + serial,
+			message: fmt.Sprintf("%s: unexpected certificate for %s issued by %s on %s (serial %s, crt.sh id %d)", domain, names, entry.IssuerName, entry.NotBefore, serial, entry.ID)})
+	}
+
+	for serial, cert := range seen {
+		if cert.NotAfter.Before(now) {
+			delete(seen, serial)
+		}
+	}
+	ctMu.Lock()
+	ctSeen[domain] = seen
+	ctMu.Unlock()
+	return
+}
+
+// allows reports whether certificates of issuer are expected.
+func (ct CertificateTransparency) allows(issuer string) bool {
+	return slices.ContainsFunc(ct.Issuers, func(allowed string) bool {
+		return strings.Contains(issuer, allowed)
+	})
+}
+
+// searchCTLogs returns the unexpired certificates for domain and its
+// subdomains from the crt.sh compatible search API at base. A search for
+// %.domain does not include domain itself, so both are searched.
+func searchCTLogs(ctx context.Context, base *retryablehttp.Client, search, domain string) (entries []ctEntry, err error) {
+	if search == "" {
+		search = defaultCTSearchURL
+	}
+	u, err := url.Parse(search)
+	if err != nil {
+		return nil, err
+	}
+	// The shared connection pool, but with the patience that crt.sh needs.
+	client := forkHTTPClient(base)
+	httpClient := *base.HTTPClient
+	httpClient.Timeout = ctTimeout
+	client.HTTPClient = &httpClient
+
+	for _, query := range []string{domain, "%." + domain} {
+		q := u.Query()
+		q.Set("q", query)
+		q.Set("output", "json")
+		q.Set("exclude", "expired")
+		u.RawQuery = q.Encode()
+		found, err := getCTEntries(ctx, client, u.String())
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, found...)
+	}
+	return entries, nil
+}
+
+func getCTEntries(ctx context.Context, client *retryablehttp.Client, url string) ([]ctEntry, error) {
+	ctx, cancel := context.WithTimeout(ctx, ctTimeout)
+	defer cancel()
+	req, err := retryablehttp.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	var entries []ctEntry
+	if err := json.NewDecoder(resp.Body).Decode(&entries); err != nil {
+		return nil, fmt.Errorf("invalid response: %w", err)
+	}
+	return entries, nil
+}
+
+// pruneCTSeen forgets the domains that are no longer monitored.
+func pruneCTSeen(targets map[checkTarget]bool) {
+	ctMu.Lock()
+	defer ctMu.Unlock()
+	for domain := range ctSeen {
+		if !targets[checkTarget{kindCT, domain}] {
+			delete(ctSeen, domain)
+		}
+	}
+}
+
+func validateCertificateTransparency(ct CertificateTransparency) error {
+	var errs []error
+	if ct.URL != "" {
+		errs = append(errs, validateURL("checkct", ct.URL))
+	}
+	for _, domain := range ct.Domains {
+		if domain == "" || strings.ContainsAny(domain, "/:%* ") {
+			errs = append(errs, fmt.Errorf("checkct: %q is not a domain", domain))
+		}
+	}
+	errs = append(errs, validateSchedule("checkct", "domains", ct.Schedule))
+	return errors.Join(errs...)
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/go-retryablehttp"
+)
+
+// fakeCTSearch serves the entries like crt.sh does: a search for yivi.app
+// finds the entries for yivi.app itself, one for %.yivi.app those for its
+// subdomains.
+func fakeCTSearch(t *testing.T, entries *[]ctEntry) *httptest.Server {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		if q.Get("output") != "json" {
+			t.Errorf("unexpected query %s", r.URL.RawQuery)
+		}
+		matches := func(name string) bool { return name == q.Get("q") }
+		if q.Get("q") == "%.yivi.app" {
+			matches = func(name string) bool { return strings.HasSuffix(name, ".yivi.app") }
+		}
+		found := []ctEntry{}
+		for _, entry := range *entries {
+			if slices.ContainsFunc(strings.Split(entry.NameValue, "\n"), matches) {
+				found = append(found, entry)
+			}
+		}
+		json.NewEncoder(w).Encode(found)
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+// newCTClient returns a client that does not retry, so that failures are
+// reported at once.
+func newCTClient() *retryablehttp.Client {
+	client := newHTTPClient()
+	client.RetryMax = 0
+	return client
+}
+
+func TestCertificateTransparency(t *testing.T) {
+	ctSeen = map[string]map[string]ctSeenCertificate{}
+	defer func() { ctSeen = map[string]map[string]ctSeenCertificate{} }()
+
+	notAfter := time.Now().AddDate(0, 2, 0).UTC().Format(ctTimeLayout)
+	entries := []ctEntry{{ID: 1, IssuerName: "C=US, O=Let's Encrypt, CN=R11", NameValue: "yivi.app", SerialNumber: "01", NotAfter: notAfter}}
+	srv := fakeCTSearch(t, &entries)
+	ct := CertificateTransparency{URL: srv.URL, Domains: []string{"yivi.app"}, Issuers: []string{"O=Let's Encrypt"}}
+
+	// The certificates found on the first search are the baseline, even
+	// those of unexpected issuers.
+	entries = append(entries, ctEntry{ID: 2, IssuerName: "C=XX, O=Old CA", NameValue: "old.yivi.app", SerialNumber: "02", NotAfter: notAfter})
+	if issues := checkCertificateTransparency(context.Background(), newCTClient(), ct, "yivi.app"); len(issues) != 0 {
+		t.Fatalf("expected no issues for the baseline, got %v", issues)
+	}
+
+	// A precertificate and certificate of an unexpected issuer are one issue.
+	rogue := ctEntry{ID: 3, IssuerName: "C=XX, O=Rogue CA", NameValue: "yivi.app\nwww.yivi.app", SerialNumber: "0A", NotAfter: notAfter}
+	entries = append(entries, rogue, rogue,
+		ctEntry{ID: 4, IssuerName: "C=US, O=Let's Encrypt, CN=R10", NameValue: "yivi.app", SerialNumber: "03", NotAfter: notAfter})
+	issues := checkCertificateTransparency(context.Background(), newCTClient(), ct, "yivi.app")
+	if len(issues) != 1 || issues[0].condition != "unexpected:0a" || issues[0].issueType != warning {
+		t.Fatalf("expected a warning for the rogue certificate, got %v", issues)
+	}
+
+	// It stays open for as long as the certificate is logged.
+	if issues := checkCertificateTransparency(context.Background(), newCTClient(), ct, "yivi.app"); len(issues) != 1 {
+		t.Errorf("expected the warning to persist, got %v", issues)
+	}
+	if _, ok := ctSeen["yivi.app"]["0a"]; !ok {
+		t.Errorf("expected the rogue certificate to be remembered")
+	}
+
+	// Both the domain and its subdomains are searched.
+	entries = append(entries, ctEntry{ID: 5, IssuerName: "C=XX, O=Rogue CA", NameValue: "yivi.app", SerialNumber: "0B", NotAfter: notAfter},
+		ctEntry{ID: 6, IssuerName: "C=XX, O=Rogue CA", NameValue: "api.yivi.app", SerialNumber: "0C", NotAfter: notAfter})
+	if issues := checkCertificateTransparency(context.Background(), newCTClient(), ct, "yivi.app"); len(issues) != 3 {
+		t.Errorf("expected the certificates for the domain and its subdomain to be reported, got %v", issues)
+	}
+}
+
+func TestCertificateTransparencyBoundsInvalidExpiry(t *testing.T) {
+	ctSeen = map[string]map[string]ctSeenCertificate{}
+	defer func() { ctSeen = map[string]map[string]ctSeenCertificate{} }()
+
+	entries := []ctEntry{{ID: 1, IssuerName: "C=XX, O=Rogue CA", NameValue: "yivi.app", SerialNumber: "01", NotAfter: "soon"}}
+	srv := fakeCTSearch(t, &entries)
+	checkCertificateTransparency(context.Background(), newCTClient(), CertificateTransparency{URL: srv.URL}, "yivi.app")
+	// A zero expiry date would never be pruned.
+	if cert, ok := ctSeen["yivi.app"]["01"]; !ok || !cert.NotAfter.After(time.Now()) || cert.NotAfter.After(time.Now().Add(ctMaxValidity)) {
+		t.Errorf("expected the certificate to be remembered for at most %s, got %+v", ctMaxValidity, cert)
+	}
+}
+
+func TestCertificateTransparencyUnreachable(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "busy", http.StatusBadGateway)
+	}))
+	defer srv.Close()
+
+	ct := CertificateTransparency{URL: srv.URL}
+	issues := checkCertificateTransparency(context.Background(), newCTClient(), ct, "yivi.app")
+	if len(issues) != 1 || issues[0].condition != "unreachable" {
+		t.Fatalf("expected an unreachable warning, got %v", issues)
+	}
+	if _, ok := ctSeen["yivi.app"]; ok {
+		t.Errorf("a failed search should not record a baseline")
+	}
+}
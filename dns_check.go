@@ -0,0 +1,294 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/netip"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+// DNSCheck resolves a name against a number of resolvers, and checks the
+// records it finds:
+//
+//	checkdns:
+//	    - name: yivi.app
+//	      resolvers: [1.1.1.1, 8.8.8.8, 9.9.9.9]
+//	      a: [203.0.113.10]
+//	      caa: ['0 issue "letsencrypt.org"']
+//	      dnssec: true
+//
+// The records of the types that have expected values must have exactly those
+// values; A and AAAA records without expected values must be the same at every
+// resolver.
+//
+// With dnssec, the resolvers must report that they validated the answers (the
+// AD flag). The watchdog does not validate the signatures itself, and the flag
+// reaches it unauthenticated, so it is only as trustworthy as the path to the
+// resolvers.
+type DNSCheck struct {
+	Name      string
+	Resolvers []string // host or host:port; defaults to the resolvers of /etc/resolv.conf
+	A         []string
+	AAAA      []string
+	CNAME     []string
+	TXT       []string
+	CAA       []string // as in a zone file: flags, tag and quoted value
+	DNSSEC    bool     // require the resolvers to report that they validated the answers
+	Schedule  `yaml:",inline"`
+}
+
+// dnsTimeout bounds a single DNS query.
+const dnsTimeout = 5 * time.Second
+
+// resolvConfPath is where the resolvers are found when a check has none.
+var resolvConfPath = "/etc/resolv.conf"
+
+// expected returns the expected values per record type.
+func (c DNSCheck) expected() map[uint16][]string {
+	expected := map[uint16][]string{}
+	for rrtype, values := range map[uint16][]string{
+		dns.TypeA: c.A, dns.TypeAAAA: c.AAAA, dns.TypeCNAME: c.CNAME, dns.TypeTXT: c.TXT, dns.TypeCAA: c.CAA,
+	} {
+		if len(values) > 0 {
+			expected[rrtype] = normalizeDNSValues(rrtype, values)
+		}
+	}
+	return expected
+}
+
+// dnsAnswer is the answer of a single resolver to a query of one record type.
+type dnsAnswer struct {
+	resolver string
+	values   []string // normalized and sorted
+}
+
+func checkDNS(ctx context.Context, check DNSCheck) (ret issueEntries) {
+	log.Printf(" checking DNS records of %s", check.Name)
+	resolvers, err := dnsResolvers(check.Resolvers)
+	if err != nil {
+		return append(ret, issueEntry{issueType: warning, condition: "resolvers", message: fmt.Sprintf("%s: no resolvers: %s", check.Name, err)})
+	}
+
+	expected := check.expected()
+	types := []uint16{dns.TypeA, dns.TypeAAAA}
+	for rrtype := range expected {
+		types = append(types, rrtype)
+	}
+	slices.Sort(types)
+	types = slices.Compact(types)
+
+	client := &dns.Client{Timeout: dnsTimeout}
+	name := dns.Fqdn(check.Name)
+	for _, rrtype := range types {
+		typ := dns.TypeToString[rrtype]
+		var answers []dnsAnswer
+		for _, resolver := range resolvers {
+			msg, err := queryDNS(ctx, client, resolver, name, rrtype, check.DNSSEC)
+			if err != nil {
+				ret = append(ret, issueEntry{issueType: warning, condition: fmt.Sprintf("unreachable:%s:%s", typ, resolver),
+					message: fmt.Sprintf("%s: resolver %s did not answer the %s query: %s", check.Name, resolver, typ, err)})
+				continue
+			}
+			if msg.Rcode != dns.RcodeSuccess {
+				ret = append(ret, issueEntry{issueType: danger, condition: fmt.Sprintf("rcode:%s:%s", typ, resolver),
+					message: fmt.Sprintf("%s: resolver %s answered the %s query with %s", check.Name, resolver, typ, dns.RcodeToString[msg.Rcode])})
+				continue
+			}
+			if check.DNSSEC && !msg.AuthenticatedData {
+				ret = append(ret, issueEntry{issueType: danger, condition: fmt.Sprintf("dnssec:%s:%s", typ, resolver),
+					message: fmt.Sprintf("%s: resolver %s did not report the %s records as validated with DNSSEC", check.Name, resolver, typ)})
+			}
+			answer := dnsAnswer{resolver, dnsValues(msg, rrtype)}
+			if want, ok := expected[rrtype]; ok && !slices.Equal(answer.values, want) {
+				ret = append(ret, issueEntry{issueType: danger, condition: fmt.Sprintf("mismatch:%s:%s", typ, resolver),
+					message: fmt.Sprintf("%s: resolver %s returned %s records %s, expected %s", check.Name, resolver, typ, formatDNSValues(answer.values), formatDNSValues(want))})
+			}
+			answers = append(answers, answer)
+		}
+		// Disagreement about expected records is reported as mismatches.
+		if _, ok := expected[rrtype]; !ok {
+			ret = append(ret, dnsDisagreements(check.Name, typ, answers)...)
+		}
+	}
+	return
+}
+
+// dnsDisagreements reports the resolvers whose answer differs from the one
+// most resolvers gave, or from the first resolver's on a tie.
+func dnsDisagreements(name, typ string, answers []dnsAnswer) (ret issueEntries) {
+	count := map[string]int{}
+	var majority string
+	for _, answer := range answers {
+		key := strings.Join(answer.values, "\n")
+		count[key]++
+		if count[key] > count[majority] {
+			majority = key
+		}
+	}
+	for _, answer := range answers {
+		if strings.Join(answer.values, "\n") == majority {
+			continue
+		}
+		ret = append(ret, issueEntry{issueType: warning, condition: fmt.Sprintf("disagree:%s:%s", typ, answer.resolver),
+			message: fmt.Sprintf("%s: resolver %s returned %s records %s, while the other resolvers returned %s",
+				name, answer.resolver, typ, formatDNSValues(answer.values), formatDNSValues(strings.Split(majority, "\n")))})
+	}
+	return
+}
+
+// queryDNS asks resolver for the records of type rrtype of name, over TCP if
+// the answer does not fit in a UDP packet.
+func queryDNS(ctx context.Context, client *dns.Client, resolver, name string, rrtype uint16, dnssec bool) (*dns.Msg, error) {
+	query := new(dns.Msg)
+	query.SetQuestion(name, rrtype)
+	query.SetEdns0(4096, dnssec)
+	// Ask for the result of the validation, which the resolver only reports
+	// to clients that signal they understand it.
+	query.AuthenticatedData = dnssec
+
+	ctx, cancel := context.WithTimeout(ctx, dnsTimeout)
+	defer cancel()
+	msg, _, err := client.ExchangeContext(ctx, query, resolver)
+	if err == nil && msg.Truncated {
+		tcp := *client
+		tcp.Net = "tcp"
+		msg, _, err = tcp.ExchangeContext(ctx, query, resolver)
+	}
+	return msg, err
+}
+
+// dnsValues returns the normalized values of the records of type rrtype in
+// the answer of msg, sorted. Other records, such as the CNAMEs leading to an
+// A record, are skipped.
+func dnsValues(msg *dns.Msg, rrtype uint16) (values []string) {
+	for _, rr := range msg.Answer {
+		if rr.Header().Rrtype != rrtype {
+			continue
+		}
+		switch rr := rr.(type) {
+		case *dns.A:
+			values = append(values, rr.A.String())
+		case *dns.AAAA:
+			values = append(values, rr.AAAA.String())
+		case *dns.CNAME:
+			values = append(values, normalizeDNSValue(dns.TypeCNAME, rr.Target))
+		case *dns.TXT:
+			values = append(values, strings.Join(rr.Txt, ""))
+		case *dns.CAA:
+			values = append(values, fmt.Sprintf("%d %s %q", rr.Flag, strings.ToLower(rr.Tag), rr.Value))
+		}
+	}
+	slices.Sort(values)
+	return slices.Compact(values)
+}
+
+// normalizeDNSValues brings configured values in the form of dnsValues.
+func normalizeDNSValues(rrtype uint16, values []string) []string {
+	normalized := make([]string, 0, len(values))
+	for _, value := range values {
+		normalized = append(normalized, normalizeDNSValue(rrtype, value))
+	}
+	slices.Sort(normalized)
+	return slices.Compact(normalized)
+}
+
+func normalizeDNSValue(rrtype uint16, value string) string {
+	switch rrtype {
+	case dns.TypeA, dns.TypeAAAA:
+		if addr, err := netip.ParseAddr(value); err == nil {
+			return addr.String()
+		}
+	case dns.TypeCNAME:
+		return strings.ToLower(strings.TrimSuffix(value, "."))
+	case dns.TypeCAA:
+		// Parsed as a zone file record, so that the quoting is canonical.
+		if rr, err := dns.NewRR(". CAA " + value); err == nil {
+			if caa, ok := rr.(*dns.CAA); ok {
+				return fmt.Sprintf("%d %s %q", caa.Flag, strings.ToLower(caa.Tag), caa.Value)
+			}
+		}
+	}
+	return value
+}
+
+func formatDNSValues(values []string) string {
+	if len(values) == 0 || len(values) == 1 && values[0] == "" {
+		return "(none)"
+	}
+	return strings.Join(values, ", ")
+}
+
+// dnsResolvers returns the addresses of the configured resolvers, or of those
+// of the system if none are configured.
+func dnsResolvers(configured []string) ([]string, error) {
+	if len(configured) == 0 {
+		cc, err := dns.ClientConfigFromFile(resolvConfPath)
+		if err != nil {
+			return nil, err
+		}
+		if len(cc.Servers) == 0 {
+			return nil, fmt.Errorf("%s lists no nameservers", resolvConfPath)
+		}
+		for _, server := range cc.Servers {
+			configured = append(configured, net.JoinHostPort(server, cc.Port))
+		}
+		return configured, nil
+	}
+	resolvers := make([]string, 0, len(configured))
+	for _, resolver := range configured {
+		addr, err := dnsResolverAddress(resolver)
+		if err != nil {
+			return nil, err
+		}
+		resolvers = append(resolvers, addr)
+	}
+	return resolvers, nil
+}
+
+// dnsResolverAddress adds the default port to resolver if it has none.
+func dnsResolverAddress(resolver string) (string, error) {
+	host, port, err := net.SplitHostPort(resolver)
+	if err != nil {
+		host, port = strings.Trim(resolver, "[]"), "53"
+	}
+	if _, err := strconv.ParseUint(port, 10, 16); err != nil || host == "" || strings.ContainsAny(host, "/ ") {
+		return "", fmt.Errorf("%q is not a resolver address", resolver)
+	}
+	return net.JoinHostPort(host, port), nil
+}
+
+func validateDNSCheck(check DNSCheck) error {
+	if _, ok := dns.IsDomainName(check.Name); !ok || check.Name == "" {
+		return fmt.Errorf("checkdns: %q is not a domain name", check.Name)
+	}
+	errs := []error{validateSchedule("checkdns", check.Name, check.Schedule)}
+	for _, resolver := range check.Resolvers {
+		if _, err := dnsResolverAddress(resolver); err != nil {
+			errs = append(errs, fmt.Errorf("checkdns: %s: %w", check.Name, err))
+		}
+	}
+	for _, value := range check.A {
+		if addr, err := netip.ParseAddr(value); err != nil || !addr.Is4() {
+			errs = append(errs, fmt.Errorf("checkdns: %s: %q is not an IPv4 address", check.Name, value))
+		}
+	}
+	for _, value := range check.AAAA {
+		if addr, err := netip.ParseAddr(value); err != nil || !addr.Is6() {
+			errs = append(errs, fmt.Errorf("checkdns: %s: %q is not an IPv6 address", check.Name, value))
+		}
+	}
+	for _, value := range check.CAA {
+		if _, err := dns.NewRR(". CAA " + value); err != nil {
+			errs = append(errs, fmt.Errorf("checkdns: %s: invalid CAA record %q: %w", check.Name, value, err))
+		}
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"context"
+	"net"
+	"testing"
+
+	"github.com/miekg/dns"
+)
+
+// fakeResolver answers A and CAA queries for yivi.app with the given address
+// and the Let's Encrypt CAA record, and sets the AD flag if validated.
+func fakeResolver(t *testing.T, addr string, validated bool) string {
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := &dns.Server{PacketConn: pc, Handler: dns.HandlerFunc(func(w dns.ResponseWriter, r *dns.Msg) {
+		m := new(dns.Msg)
+		m.SetReply(r)
+		m.AuthenticatedData = validated
+		q := r.Question[0]
+		switch {
+		case q.Name != "yivi.app.":
+			m.Rcode = dns.RcodeNameError
+		case q.Qtype == dns.TypeA:
+			rr, _ := dns.NewRR("yivi.app. 300 IN A " + addr)
+			m.Answer = append(m.Answer, rr)
+		case q.Qtype == dns.TypeCAA:
+			rr, _ := dns.NewRR(`yivi.app. 300 IN CAA 0 issue "letsencrypt.org"`)
+			m.Answer = append(m.Answer, rr)
+		}
+		w.WriteMsg(m)
+	})}
+	go srv.ActivateAndServe()
+	t.Cleanup(func() { srv.Shutdown() })
+	return pc.LocalAddr().String()
+}
+
+func TestCheckDNS(t *testing.T) {
+	one := fakeResolver(t, "203.0.113.10", true)
+	two := fakeResolver(t, "203.0.113.10", true)
+	rogue := fakeResolver(t, "198.51.100.1", false)
+
+	check := DNSCheck{Name: "yivi.app", Resolvers: []string{one, two}, CAA: []string{`0 issue "letsencrypt.org"`}, DNSSEC: true}
+	if issues := checkDNS(context.Background(), check); len(issues) != 0 {
+		t.Fatalf("expected no issues, got %v", issues)
+	}
+
+	// Without expected A records, the resolvers have to agree.
+	check.Resolvers = []string{one, rogue, two}
+	check.CAA = nil
+	issues := checkDNS(context.Background(), check)
+	conditions := map[string]bool{}
+	for _, issue := range issues {
+		conditions[issue.condition] = true
+	}
+	for _, want := range []string{"disagree:A:" + rogue, "dnssec:A:" + rogue, "dnssec:AAAA:" + rogue} {
+		if !conditions[want] {
+			t.Errorf("expected an issue %s, got %v", want, issues)
+		}
+	}
+	if len(issues) != 3 {
+		t.Errorf("expected only issues for the rogue resolver, got %v", issues)
+	}
+
+	check.A = []string{"203.0.113.10"}
+	issues = checkDNS(context.Background(), check)
+	if len(issues) != 3 || issues[1].condition != "mismatch:A:"+rogue || issues[1].issueType != danger {
+		t.Errorf("expected a mismatch at the rogue resolver, got %v", issues)
+	}
+
+	// Expected records of other types don't stop the A records from being
+	// compared.
+	check = DNSCheck{Name: "yivi.app", Resolvers: []string{one, rogue, two}, CAA: []string{`0 issue "letsencrypt.org"`}}
+	issues = checkDNS(context.Background(), check)
+	if len(issues) != 1 || issues[0].condition != "disagree:A:"+rogue {
+		t.Errorf("expected the rogue resolver to disagree, got %v", issues)
+	}
+
+	check = DNSCheck{Name: "irma.app", Resolvers: []string{one}}
+	if issues := checkDNS(context.Background(), check); len(issues) != 2 || issues[0].condition != "rcode:A:"+one {
+		t.Errorf("expected NXDOMAIN issues, got %v", issues)
+	}
+}
+
+func TestValidateDNSCheck(t *testing.T) {
+	valid := DNSCheck{Name: "yivi.app", Resolvers: []string{"1.1.1.1", "[2606:4700::1111]:53"}, A: []string{"203.0.113.10"},
+		AAAA: []string{"2001:db8::1"}, CAA: []string{`0 issue "letsencrypt.org"`}}
+	if err := validateDNSCheck(valid); err != nil {
+		t.Errorf("expected valid check, got %s", err)
+	}
+	for _, check := range []DNSCheck{
+		{},
+		{Name: "yivi.app", A: []string{"2001:db8::1"}},
+		{Name: "yivi.app", CAA: []string{"issue"}},
+		{Name: "yivi.app", Resolvers: []string{"https://1.1.1.1/dns-query"}},
+	} {
+		if err := validateDNSCheck(check); err == nil {
+			t.Errorf("expected %+v to be invalid", check)
+		}
+	}
+}
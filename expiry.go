@@ -0,0 +1,116 @@
+package main
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	irma "github.com/privacybydesign/irmago"
+)
+
+// ExpiryHorizons are the number of days before an expiry date at which it is
+// reported, as info, warning or danger. Zero disables a tier; whatever has
+// expired already is always a danger.
+//
+//	expiry: {info: 60, warning: 30, danger: 7}
+type ExpiryHorizons struct {
+	Info    int
+	Warning int
+	Danger  int
+}
+
+// orDefault returns h, or def if h sets no tier at all.
+func (h ExpiryHorizons) orDefault(def ExpiryHorizons) ExpiryHorizons {
+	if h == (ExpiryHorizons{}) {
+		return def
+	}
+	return h
+}
+
+// severity returns the severity with which an expiry at notAfter is reported
+// at now, and false if it is not to be reported yet.
+func (h ExpiryHorizons) severity(notAfter, now time.Time) (issueType, bool) {
+	if !now.Before(notAfter) {
+		return danger, true
+	}
+	daysLeft := int(notAfter.Sub(now).Hours() / 24)
+	for _, tier := range []struct {
+		days      int
+		issueType issueType
+	}{{h.Danger, danger}, {h.Warning, warning}, {h.Info, info}} {
+		if daysLeft < tier.days {
+			return tier.issueType, true
+		}
+	}
+	return 0, false
+}
+
+// validateExpiryHorizons rejects negative horizons, and tiers that could never
+// be reached because a more severe tier starts earlier.
+func validateExpiryHorizons(section string, h ExpiryHorizons) error {
+	if h.Info < 0 || h.Warning < 0 || h.Danger < 0 {
+		return fmt.Errorf("%s: expiry horizons must not be negative, got %+v", section, h)
+	}
+	var enabled []int
+	for _, days := range []int{h.Danger, h.Warning, h.Info} {
+		if days > 0 {
+			enabled = append(enabled, days)
+		}
+	}
+	if !slices.IsSorted(enabled) {
+		return fmt.Errorf("%s: expiry horizons must satisfy danger <= warning <= info, got %+v", section, h)
+	}
+	return nil
+}
+
+// checkIssuerKeys reports the latest public key of every issuer of the scheme
+// that expires within the horizons. Older keys are left alone: they are kept
+// only to verify what was issued with them. The caller must hold schemeMu.
+func checkIssuerKeys(irmaConfig *irma.Configuration, scheme *irma.SchemeManager, horizons ExpiryHorizons, now time.Time) (ret issueEntries) {
+	id := scheme.Identifier()
+	var issuers []irma.IssuerIdentifier
+	for issuerID, issuer := range irmaConfig.Issuers {
+		deprecated := !issuer.DeprecatedSince.IsZero() && !time.Time(issuer.DeprecatedSince).After(now)
+		if issuerID.SchemeManagerIdentifier() == id && !deprecated {
+			issuers = append(issuers, issuerID)
+		}
+	}
+	slices.SortFunc(issuers, func(a, b irma.IssuerIdentifier) int { return strings.Compare(a.String(), b.String()) })
+
+	for _, issuerID := range issuers {
+		counters, err := irmaConfig.PublicKeyIndices(issuerID)
+		if err != nil || len(counters) == 0 {
+			continue // not our business: ValidateKeys reports these
+		}
+		counter := slices.Max(counters)
+		pk, err := irmaConfig.PublicKey(issuerID, counter)
+		if err != nil || pk == nil {
+			continue
+		}
+		expiry := time.Unix(pk.ExpiryDate, 0)
+		severity, ok := horizons.severity(expiry, now)
+		if !ok {
+			continue
+		}
+		date := expiry.UTC().Format(time.DateOnly)
+		key := fmt.Sprintf("%s:%d", issuerID, counter)
+		// One condition for the key, so that expiring is an escalation.
+		if !now.Before(expiry) {
+			ret = append(ret, issueEntry{issueType: danger, condition: "key-expiry:" + key,
+				message: fmt.Sprintf("%s: public key %d of issuer %s has expired on %s", scheme.URL, counter, issuerID, date)})
+			continue
+		}
+		ret = append(ret, issueEntry{issueType: severity, condition: "key-expiry:" + key,
+			message: fmt.Sprintf("%s: public key %d of issuer %s expires on %s (in %d days)", scheme.URL, counter, issuerID, date, int(expiry.Sub(now).Hours()/24))})
+	}
+	return
+}
+
+// isKeyExpiryWarning reports whether warn is one of the warnings about the
+// expiry of public keys of irmaConfig.ValidateKeys, which checkIssuerKeys
+// supersedes.
+func isKeyExpiryWarning(warn string) bool {
+	return strings.HasSuffix(warn, "has no nonexpired public keys") ||
+		(strings.HasPrefix(warn, "Latest public key of issuer ") && strings.Contains(warn, "expires soon"))
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"context"
+	"crypto/x509"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestExpiryHorizonsSeverity(t *testing.T) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	horizons := ExpiryHorizons{Info: 60, Warning: 30, Danger: 7}
+	for _, tc := range []struct {
+		daysLeft float64
+		want     string // "" for not reported
+	}{
+		{90, ""},
+		{45, "info"},
+		{29.5, "warning"},
+		{3, "danger"},
+		{-1, "danger"},
+	} {
+		severity, ok := horizons.severity(now.Add(time.Duration(tc.daysLeft*24)*time.Hour), now)
+		got := ""
+		if ok {
+			got = severity.String()
+		}
+		if got != tc.want {
+			t.Errorf("%v days left: got %q, want %q", tc.daysLeft, got, tc.want)
+		}
+	}
+
+	if _, ok := (ExpiryHorizons{Warning: 30}).severity(now.Add(45*24*time.Hour), now); ok {
+		t.Errorf("expected a disabled info tier not to report")
+	}
+	if got := (ExpiryHorizons{}).orDefault(horizons); got != horizons {
+		t.Errorf("expected the default for unset horizons, got %+v", got)
+	}
+}
+
+func TestCheckCertificateExpiryOfUsesHorizons(t *testing.T) {
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer srv.Close()
+	client := newHTTPClient()
+	client.HTTPClient = srv.Client()
+
+	if issues := checkCertificateExpiryOf(context.Background(), client, srv.URL, ExpiryHorizons{Warning: 30}); len(issues) != 0 {
+		t.Errorf("expected no issues for a certificate that is valid for years, got %+v", issues)
+	}
+
+	daysLeft := int(time.Until(srv.Certificate().NotAfter).Hours() / 24)
+	issues := checkCertificateExpiryOf(context.Background(), client, srv.URL, ExpiryHorizons{Info: daysLeft + 1})
+	if len(issues) != 1 || issues[0].issueType != info || issues[0].condition != "expiry:"+srv.Certificate().SerialNumber.Text(16) {
+		t.Errorf("expected an info issue, got %+v", issues)
+	}
+}
+
+// TestCertificateExpiryIsEscalated: a certificate that expires is the same
+// issue, only more severe, rather than a fixed and a new one.
+func TestCertificateExpiryIsEscalated(t *testing.T) {
+	notAfter := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	cert := &x509.Certificate{SerialNumber: big.NewInt(0x3f), NotAfter: notAfter}
+	horizons := ExpiryHorizons{Warning: 30}
+
+	before := certificateExpiryIssues("https://yivi.app", []*x509.Certificate{cert}, horizons, notAfter.Add(-time.Hour))
+	after := certificateExpiryIssues("https://yivi.app", []*x509.Certificate{cert}, horizons, notAfter.Add(time.Hour))
+	newIssues, fixedIssues := difference(before.tag(kindCertificate, "https://yivi.app"), after.tag(kindCertificate, "https://yivi.app"))
+	if len(newIssues) != 1 || newIssues[0].issueType != danger || len(fixedIssues) != 0 {
+		t.Errorf("expected the expiry to be announced as an escalation only, got new=%v fixed=%v", newIssues.messages(), fixedIssues.messages())
+	}
+}
+
+func TestIsKeyExpiryWarning(t *testing.T) {
+	for warn, want := range map[string]bool{
+		"Issuer pbdf.gemeente has no nonexpired public keys":                              true,
+		"Latest public key of issuer pbdf.gemeente expires soon (at 2024-01-01 00:00:00)": true,
+		"Credential type pbdf.gemeente.address has no logo":                               false,
+	} {
+		if got := isKeyExpiryWarning(warn); got != want {
+			t.Errorf("%q: got %t, want %t", warn, got, want)
+		}
+	}
+}
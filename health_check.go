@@ -1,13 +1,21 @@
 package main
 
 import (
+	"bytes"
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"log"
+	"maps"
 	"net/http"
 	"net/http/httptrace"
+	"net/url"
+	"regexp"
+	"slices"
 	"strings"
+	"time"
 
 	"github.com/hashicorp/go-retryablehttp"
 )
@@ -18,47 +26,86 @@ type HealthCheck struct {
 	RequestHeaders map[string]string
 	RequestBody    string
 
-	ResponseStatusCodeEquals int // Defaults to 200
+	FollowRedirects *bool // Defaults to true
+
+	ResponseStatusCodeEquals int         // Defaults to 200, or to any 3xx when not following redirects
+	ResponseStatusCodes      StatusCodes // if set, replaces ResponseStatusCodeEquals
+	ResponseLocation         string      // expected redirect target; requires FollowRedirects false
 	ResponseHeaderContains   map[string]string
+	ResponseHeaderMatches    map[string]string // header name: regular expression
 	ResponseBodyContains     string
+	ResponseBodyContainsAll  []string
+	ResponseBodyNotContains  []string // none of these may occur in the body
+	ResponseBodyMatches      []string // regular expressions that must match the body
+	ResponseJSON             []string // assertions on the JSON body; see jsonAssertion
+	ResponseTime             LatencyThresholds
+
+	Schedule `yaml:",inline"`
 }
 
-func runHealthChecks(checks []HealthCheck) (issues issueEntries) {
-	// Re-use the same HTTP client for all checks to prevent false positives due to DNS resolution, TLS handshake issues or connection starvastion
-	client := newHTTPClient()
-	issueChan := make(chan *issueEntry, len(checks))
+func (check HealthCheck) followsRedirects() bool {
+	return check.FollowRedirects == nil || *check.FollowRedirects
+}
 
-	for _, check := range checks {
-		check := check
-		issueChan <- runHealthCheck(client, check)
+// statusCodes returns the status codes the check accepts.
+func (check HealthCheck) statusCodes() StatusCodes {
+	if len(check.ResponseStatusCodes) > 0 {
+		return check.ResponseStatusCodes
 	}
+	return StatusCodes{{check.ResponseStatusCodeEquals, check.ResponseStatusCodeEquals}}
+}
 
-	close(issueChan)
+// LatencyThresholds are the response times above which a health check reports
+// an issue, even though the response itself is fine. Total is the time until
+// the response body was read, TTFB the time until its first byte arrived. Zero
+// disables a threshold.
+type LatencyThresholds struct {
+	TotalWarning time.Duration
+	TotalDanger  time.Duration
+	TTFBWarning  time.Duration
+	TTFBDanger   time.Duration
+}
 
-	for issue := range issueChan {
-		if issue != nil {
-			issues = append(issues, *issue)
-		}
-	}
-	return
+func runHealthCheck(ctx context.Context, client *retryablehttp.Client, check HealthCheck) *issueEntry {
+	issue, _ := doHealthCheck(ctx, client, check, checkTarget{kindHealthCheck, check.RequestURL})
+	return issue
 }
 
-func runHealthCheck(client *retryablehttp.Client, check HealthCheck) *issueEntry {
+// doHealthCheck is runHealthCheck for a check that is part of target, under
+// which its timings are recorded. If the request succeeded, it also returns
+// the response, with the body still readable.
+func doHealthCheck(ctx context.Context, client *retryablehttp.Client, check HealthCheck, target checkTarget) (*issueEntry, *http.Response) {
 	log.Printf(" checking HTTP endpoint %s", check.RequestURL)
 
+	// The hooks below are per check, so don't install them on the shared client.
+	client = forkHTTPClient(client)
+
 	// Set defaults
 	if check.RequestMethod == "" {
 		check.RequestMethod = "GET"
 	}
-	if check.ResponseStatusCodeEquals == 0 {
-		check.ResponseStatusCodeEquals = 200
+	if check.ResponseStatusCodeEquals == 0 && len(check.ResponseStatusCodes) == 0 {
+		if check.followsRedirects() {
+			check.ResponseStatusCodeEquals = 200
+		} else {
+			// Not following redirects means expecting one.
+			check.ResponseStatusCodes = StatusCodes{{300, 399}}
+		}
+	}
+	if !check.followsRedirects() {
+		// Shares the connection pool, like forkHTTPClient.
+		httpClient := *client.HTTPClient
+		httpClient.CheckRedirect = func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		}
+		client.HTTPClient = &httpClient
 	}
 
 	// Use retryablehttp to prevent false positives.
-	req, err := retryablehttp.NewRequest(check.RequestMethod, check.RequestURL, []byte(check.RequestBody))
+	req, err := retryablehttp.NewRequestWithContext(ctx, check.RequestMethod, check.RequestURL, []byte(check.RequestBody))
 	if err != nil {
 		log.Printf("Health check %s: %s", check.RequestURL, err)
-		return &issueEntry{warning, fmt.Sprintf("%s: invalid health check", check.RequestURL)}
+		return &issueEntry{issueType: warning, condition: "invalid", message: fmt.Sprintf("%s: invalid health check", check.RequestURL)}, nil
 	}
 	for key, value := range check.RequestHeaders {
 		req.Header.Set(key, value)
@@ -72,7 +119,7 @@ func runHealthCheck(client *retryablehttp.Client, check HealthCheck) *issueEntry
 		trace.reset(attempt)
 	}
 
-	var issue *issueEntry
+	var issue, slow *issueEntry
 
 	client.CheckRetry = func(ctx context.Context, resp *http.Response, respErr error) (bool, error) {
 		// Do not retry if the check's context was cancelled.
@@ -82,8 +129,10 @@ func runHealthCheck(client *retryablehttp.Client, check HealthCheck) *issueEntry
 
 		newIssue := generateHealthCheckIssueEntry(check, resp, respErr)
 
-		// If no issue is found during the check, we can stop retrying.
+		// If no issue is found during the check, we can stop retrying. Slowness
+		// is not retried: a fast second attempt would hide it.
 		if newIssue == nil {
+			slow = latencyIssue(check, trace)
 			return false, nil
 		}
 		logFailedAttempt(check.RequestMethod, check.RequestURL, trace, respErr)
@@ -91,42 +140,178 @@ func runHealthCheck(client *retryablehttp.Client, check HealthCheck) *issueEntry
 		return true, nil
 	}
 
-	_, err = client.Do(req)
+	resp, err := client.Do(req)
+	recordRequestPhases(target.kind, target.target, trace)
 	if issue == nil && err != nil {
 		issue = &issueEntry{
-			danger,
-			fmt.Sprint("Health check failed unexpectedly: ", err),
+			issueType: danger,
+			condition: "failed",
+			message:   fmt.Sprint("Health check failed unexpectedly: ", err),
 		}
 	}
 	if issue != nil && err == nil {
 		issue.issueType = warning
+		issue.condition = "unstable:" + issue.condition
 		issue.message = fmt.Sprint("Unstable health check: ", issue.message)
 	}
-	return issue
+	if slow != nil && (issue == nil || slow.issueType > issue.issueType) {
+		issue = slow
+	}
+	if err != nil {
+		return issue, nil
+	}
+	return issue, resp
+}
+
+// latencyIssue checks the timings of a successful attempt against the
+// thresholds of check. The message includes the phase breakdown, so that it
+// tells whether DNS, the connection or the server itself was slow.
+func latencyIssue(check HealthCheck, trace *requestTrace) *issueEntry {
+	limits := check.ResponseTime
+	total := trace.elapsed()
+	ttfb, haveTTFB := trace.phases()["ttfb"]
+
+	var exceeded []string
+	severity := warning
+	exceeds := func(name string, d, warn, dang time.Duration) {
+		switch {
+		case dang > 0 && d > dang:
+			severity = danger
+			exceeded = append(exceeded, fmt.Sprintf("%s %s > %s", name, d.Round(time.Millisecond), dang))
+		case warn > 0 && d > warn:
+			exceeded = append(exceeded, fmt.Sprintf("%s %s > %s", name, d.Round(time.Millisecond), warn))
+		}
+	}
+	exceeds("total", total, limits.TotalWarning, limits.TotalDanger)
+	if haveTTFB {
+		exceeds("ttfb", ttfb, limits.TTFBWarning, limits.TTFBDanger)
+	}
+	if len(exceeded) == 0 {
+		return nil
+	}
+	return &issueEntry{
+		issueType: severity,
+		condition: "slow", // a change of severity is announced by difference
+		message:   fmt.Sprintf("%s: slow response: %s (%s)", check.RequestURL, strings.Join(exceeded, ", "), trace.summary()),
+	}
 }
 
 func generateHealthCheckIssueEntry(check HealthCheck, resp *http.Response, respErr error) *issueEntry {
 	if respErr != nil {
-		return &issueEntry{danger, fmt.Sprintf("%s: cannot be reached", check.RequestURL)}
+		return &issueEntry{issueType: danger, condition: "unreachable", message: fmt.Sprintf("%s: cannot be reached", check.RequestURL)}
 	}
 	respBody, err := io.ReadAll(resp.Body)
 	if err != nil {
-		return &issueEntry{danger, fmt.Sprintf("%s: response body could not be read", check.RequestURL)}
+		return &issueEntry{issueType: danger, condition: "unreadable-body", message: fmt.Sprintf("%s: response body could not be read", check.RequestURL)}
 	}
+	// Keep the body around for doHealthCheck's caller.
+	resp.Body = io.NopCloser(bytes.NewReader(respBody))
 
-	if resp.StatusCode != check.ResponseStatusCodeEquals {
-		return &issueEntry{danger, fmt.Sprintf("%s: received unexpected status code %d (expected %d)", check.RequestURL, resp.StatusCode, check.ResponseStatusCodeEquals)}
+	if codes := check.statusCodes(); !codes.contains(resp.StatusCode) {
+		return &issueEntry{issueType: danger, condition: "status-code", message: fmt.Sprintf("%s: received unexpected status code %d (expected %s)", check.RequestURL, resp.StatusCode, codes)}
+	}
+
+	if check.ResponseLocation != "" {
+		want, err := url.Parse(check.RequestURL)
+		if err == nil {
+			want, err = want.Parse(check.ResponseLocation)
+		}
+		got, gotErr := resp.Location()
+		if err != nil || gotErr != nil || got.String() != want.String() {
+			return &issueEntry{issueType: danger, condition: "location", message: fmt.Sprintf("%s: redirects to %q instead of %q", check.RequestURL, resp.Header.Get("Location"), check.ResponseLocation)}
+		}
 	}
 
 	for key, value := range check.ResponseHeaderContains {
 		if resp.Header.Get(key) != value {
-			return &issueEntry{danger, fmt.Sprintf("%s: expected response header \"%s: %s\" could not be found", check.RequestURL, key, value)}
+			return &issueEntry{issueType: danger, condition: "missing-header:" + key, message: fmt.Sprintf("%s: expected response header \"%s: %s\" could not be found", check.RequestURL, key, value)}
+		}
+	}
+
+	for key, pattern := range check.ResponseHeaderMatches {
+		if re, err := regexp.Compile(pattern); err != nil || !re.MatchString(resp.Header.Get(key)) {
+			return &issueEntry{issueType: danger, condition: "header-mismatch:" + key, message: fmt.Sprintf("%s: response header %s does not match %q", check.RequestURL, key, pattern)}
 		}
 	}
 
 	if !strings.Contains(string(respBody), check.ResponseBodyContains) {
 		log.Printf("response body %q should contain %q, but it was not found", truncateForLog(string(respBody)), check.ResponseBodyContains)
-		return &issueEntry{danger, fmt.Sprintf("%s: expected response body \"%s\" could not be found", check.RequestURL, check.ResponseBodyContains)}
+		return &issueEntry{issueType: danger, condition: "missing-body", message: fmt.Sprintf("%s: expected response body \"%s\" could not be found", check.RequestURL, check.ResponseBodyContains)}
+	}
+	for _, want := range check.ResponseBodyContainsAll {
+		if !strings.Contains(string(respBody), want) {
+			log.Printf("response body %q should contain %q, but it was not found", truncateForLog(string(respBody)), want)
+			return &issueEntry{issueType: danger, condition: "missing-body:" + want, message: fmt.Sprintf("%s: expected response body \"%s\" could not be found", check.RequestURL, want)}
+		}
+	}
+	for _, unwanted := range check.ResponseBodyNotContains {
+		if strings.Contains(string(respBody), unwanted) {
+			return &issueEntry{issueType: danger, condition: "unwanted-body:" + unwanted, message: fmt.Sprintf("%s: response body contains \"%s\"", check.RequestURL, unwanted)}
+		}
+	}
+	for _, pattern := range check.ResponseBodyMatches {
+		if re, err := regexp.Compile(pattern); err != nil || !re.Match(respBody) {
+			log.Printf("response body %q should match %q, but it does not", truncateForLog(string(respBody)), pattern)
+			return &issueEntry{issueType: danger, condition: "body-mismatch:" + pattern, message: fmt.Sprintf("%s: response body does not match %q", check.RequestURL, pattern)}
+		}
+	}
+
+	if len(check.ResponseJSON) > 0 {
+		var doc any
+		if err := json.Unmarshal(respBody, &doc); err != nil {
+			return &issueEntry{issueType: danger, condition: "invalid-json", message: fmt.Sprintf("%s: response body is not JSON: %s", check.RequestURL, err)}
+		}
+		for _, raw := range check.ResponseJSON {
+			assertion, err := parseJSONAssertion(raw)
+			if err == nil {
+				err = assertion.check(doc)
+			}
+			if err != nil {
+				return &issueEntry{issueType: danger, condition: "json:" + raw, message: fmt.Sprintf("%s: %s", check.RequestURL, err)}
+			}
+		}
 	}
 	return nil
 }
+
+// validateHealthCheck rejects settings that cannot work, such as regular
+// expressions that don't compile; at check time they would only fail as a
+// confusing issue.
+func validateHealthCheck(check HealthCheck) error {
+	var errs []error
+	if check.ResponseLocation != "" && check.followsRedirects() {
+		errs = append(errs, fmt.Errorf("healthchecks: %s: responselocation requires followredirects: false", check.RequestURL))
+	}
+	for _, pattern := range slices.Concat(slices.Collect(maps.Values(check.ResponseHeaderMatches)), check.ResponseBodyMatches) {
+		if _, err := regexp.Compile(pattern); err != nil {
+			errs = append(errs, fmt.Errorf("healthchecks: %s: %w", check.RequestURL, err))
+		}
+	}
+	for _, raw := range check.ResponseJSON {
+		if _, err := parseJSONAssertion(raw); err != nil {
+			errs = append(errs, fmt.Errorf("healthchecks: %s: %w", check.RequestURL, err))
+		}
+	}
+	if err := check.ResponseTime.validate(); err != nil {
+		errs = append(errs, fmt.Errorf("healthchecks: %s: responsetime: %w", check.RequestURL, err))
+	}
+	return errors.Join(errs...)
+}
+
+// validate rejects negative thresholds, and warnings that are only given once
+// the danger threshold has been passed already.
+func (l LatencyThresholds) validate() error {
+	var errs []error
+	for _, t := range []struct {
+		name       string
+		warn, dang time.Duration
+	}{{"total", l.TotalWarning, l.TotalDanger}, {"ttfb", l.TTFBWarning, l.TTFBDanger}} {
+		name, warn, dang := t.name, t.warn, t.dang
+		if warn < 0 || dang < 0 {
+			errs = append(errs, fmt.Errorf("%s thresholds must not be negative", name))
+		} else if warn > 0 && dang > 0 && warn > dang {
+			errs = append(errs, fmt.Errorf("%swarning %s exceeds %sdanger %s", name, warn, name, dang))
+		}
+	}
+	return errors.Join(errs...)
+}
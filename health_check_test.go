@@ -0,0 +1,111 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRunHealthCheckReportsSlowResponse(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(100 * time.Millisecond)
+		w.Write([]byte("ok"))
+	}))
+	defer srv.Close()
+
+	check := HealthCheck{RequestURL: srv.URL, ResponseTime: LatencyThresholds{TotalWarning: 50 * time.Millisecond, TTFBDanger: time.Minute}}
+	issue := runHealthCheck(context.Background(), newHTTPClient(), check)
+	if issue == nil || issue.issueType != warning || issue.condition != "slow" {
+		t.Fatalf("expected a slow response warning, got %+v", issue)
+	}
+	if !strings.Contains(issue.message, "total") || !strings.Contains(issue.message, "ttfb=") {
+		t.Errorf("expected the exceeded threshold and the phase breakdown in %q", issue.message)
+	}
+
+	check.ResponseTime.TotalDanger = 80 * time.Millisecond
+	if issue := runHealthCheck(context.Background(), newHTTPClient(), check); issue == nil || issue.issueType != danger {
+		t.Errorf("expected a slow response danger, got %+v", issue)
+	}
+
+	check.ResponseTime = LatencyThresholds{TotalWarning: time.Minute}
+	if issue := runHealthCheck(context.Background(), newHTTPClient(), check); issue != nil {
+		t.Errorf("expected no issue within the thresholds, got %+v", issue)
+	}
+}
+
+func TestGenerateHealthCheckIssueEntryBodyAssertions(t *testing.T) {
+	respond := func(body string) *http.Response {
+		rec := httptest.NewRecorder()
+		rec.Header().Set("Server", "irmago/0.14.2")
+		rec.WriteString(body)
+		return rec.Result()
+	}
+	base := HealthCheck{RequestURL: "https://yivi.app/health", ResponseStatusCodeEquals: 200}
+
+	for _, tc := range []struct {
+		name      string
+		modify    func(*HealthCheck)
+		body      string
+		condition string // "" for no issue
+	}{
+		{"contains all", func(c *HealthCheck) { c.ResponseBodyContainsAll = []string{"ok", "ready"} }, "ok, ready", ""},
+		{"missing one", func(c *HealthCheck) { c.ResponseBodyContainsAll = []string{"ok", "ready"} }, "ok", "missing-body:ready"},
+		{"not contains", func(c *HealthCheck) { c.ResponseBodyNotContains = []string{"error"} }, "internal error", "unwanted-body:error"},
+		{"regex", func(c *HealthCheck) { c.ResponseBodyMatches = []string{`^v\d+\.\d+`} }, "v0.14", ""},
+		{"regex mismatch", func(c *HealthCheck) { c.ResponseBodyMatches = []string{`^v\d+\.\d+`} }, "down", "body-mismatch:^v\\d+\\.\\d+"},
+		{"header regex", func(c *HealthCheck) { c.ResponseHeaderMatches = map[string]string{"Server": `^irmago/0\.1[4-9]`} }, "", ""},
+		{"header mismatch", func(c *HealthCheck) { c.ResponseHeaderMatches = map[string]string{"Server": `^nginx`} }, "", "header-mismatch:Server"},
+		{"json", func(c *HealthCheck) { c.ResponseJSON = []string{`$.status == "ok"`} }, `{"status": "ok"}`, ""},
+		{"json mismatch", func(c *HealthCheck) { c.ResponseJSON = []string{`$.status == "ok"`} }, `{"status": "down"}`, `json:$.status == "ok"`},
+		{"not json", func(c *HealthCheck) { c.ResponseJSON = []string{`$.status`} }, `<html>`, "invalid-json"},
+	} {
+		check := base
+		tc.modify(&check)
+		issue := generateHealthCheckIssueEntry(check, respond(tc.body), nil)
+		switch {
+		case tc.condition == "" && issue != nil:
+			t.Errorf("%s: unexpected issue %+v", tc.name, issue)
+		case tc.condition != "" && (issue == nil || issue.condition != tc.condition):
+			t.Errorf("%s: expected condition %q, got %+v", tc.name, tc.condition, issue)
+		}
+	}
+}
+
+func TestValidateHealthCheckRejectsInvalidAssertions(t *testing.T) {
+	check := HealthCheck{RequestURL: "https://yivi.app", ResponseBodyMatches: []string{"("}, ResponseJSON: []string{"status"}}
+	if err := validateHealthCheck(check); err == nil {
+		t.Errorf("expected the invalid regex and JSON assertion to be rejected")
+	}
+}
+
+func TestRunHealthCheckRedirects(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/old" {
+			http.Redirect(w, r, "/new", http.StatusMovedPermanently)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer srv.Close()
+
+	noFollow := false
+	for _, tc := range []struct {
+		name  string
+		check HealthCheck
+		ok    bool
+	}{
+		{"follow", HealthCheck{RequestURL: srv.URL + "/old", ResponseStatusCodes: StatusCodes{{200, 299}}}, true},
+		{"follow, default 200", HealthCheck{RequestURL: srv.URL + "/old"}, false},
+		{"don't follow", HealthCheck{RequestURL: srv.URL + "/old", FollowRedirects: &noFollow, ResponseLocation: "/new"}, true},
+		{"wrong location", HealthCheck{RequestURL: srv.URL + "/old", FollowRedirects: &noFollow, ResponseLocation: "/elsewhere"}, false},
+	} {
+		client := newHTTPClient()
+		client.RetryMax = 0
+		if issue := runHealthCheck(context.Background(), client, tc.check); (issue == nil) != tc.ok {
+			t.Errorf("%s: got issue %+v", tc.name, issue)
+		}
+	}
+}
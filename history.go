@@ -0,0 +1,250 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// defaultHistoryLimit is the number of events kept when Conf.HistoryLimit is
+// not set: at a handful of transitions a day, years of history.
+const defaultHistoryLimit = 10000
+
+// historyEvent is a transition of an issue, as produced by difference.
+type historyEvent struct {
+	Time  time.Time `json:"time"`
+	Event eventType `json:"event"` // eventNew or eventFixed
+	apiIssue
+}
+
+var (
+	historyMu sync.RWMutex
+	history   []historyEvent // oldest first
+)
+
+// loadHistory reads the event log at path. A missing file is an empty history.
+func loadHistory(path string) error {
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	var events []historyEvent
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(nil, 1<<20)
+	for scanner.Scan() {
+		var event historyEvent
+		if err := json.Unmarshal(scanner.Bytes(), &event); err != nil {
+			// A line torn by a crash halfway through an append; skip it.
+			log.Printf("Skipping unreadable line in %s: %s", path, err)
+			continue
+		}
+		events = append(events, event)
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+
+	historyMu.Lock()
+	history = events
+	historyMu.Unlock()
+	return nil
+}
+
+// recordHistory adds the transitions of a cycle to the history, and appends
+// them to the history file if there is one. The history is bounded by
+// HistoryLimit: when it grows beyond that, the oldest tenth of it is dropped and
+// the file is rewritten.
+func recordHistory(newIssues, fixedIssues issueEntries, now time.Time) {
+	var events []historyEvent
+	for _, issue := range newIssues {
+		events = append(events, historyEvent{Time: now, Event: eventNew, apiIssue: newAPIIssue(issue)})
+	}
+	for _, issue := range fixedIssues {
+		events = append(events, historyEvent{Time: now, Event: eventFixed, apiIssue: newAPIIssue(issue)})
+	}
+	if len(events) == 0 {
+		return
+	}
+
+	limit := conf.HistoryLimit
+	if limit <= 0 {
+		limit = defaultHistoryLimit
+	}
+
+	historyMu.Lock()
+	history = append(history, events...)
+	trimmed := len(history) > limit
+	if trimmed {
+		// Keep at least the newest event, however small the limit.
+		history = append([]historyEvent(nil), history[len(history)-max(limit*9/10, 1):]...)
+	}
+	all := history
+	historyMu.Unlock()
+
+	if conf.HistoryFile == "" {
+		return
+	}
+	var err error
+	if trimmed {
+		err = writeHistory(conf.HistoryFile, all)
+	} else {
+		err = appendHistory(conf.HistoryFile, events)
+	}
+	if err != nil {
+		log.Printf("Could not write history to %s: %s", conf.HistoryFile, err)
+	}
+}
+
+func appendHistory(path string, events []historyEvent) error {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+	if err != nil {
+		return err
+	}
+	enc := json.NewEncoder(f)
+	for _, event := range events {
+		if err := enc.Encode(event); err != nil {
+			f.Close()
+			return err
+		}
+	}
+	return f.Close()
+}
+
+// writeHistory replaces the file at path with events, atomically like
+// saveState.
+func writeHistory(path string, events []historyEvent) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name()) // no-op once renamed
+	enc := json.NewEncoder(tmp)
+	for _, event := range events {
+		if err := enc.Encode(event); err != nil {
+			tmp.Close()
+			return err
+		}
+	}
+	if err = tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// historyBetween returns the events in [since, until), newest first. A zero
+// bound is open.
+func historyBetween(since, until time.Time) []historyEvent {
+	historyMu.RLock()
+	defer historyMu.RUnlock()
+	ret := []historyEvent{}
+	for i := len(history) - 1; i >= 0; i-- {
+		event := history[i]
+		if !since.IsZero() && event.Time.Before(since) {
+			break
+		}
+		if !until.IsZero() && !event.Time.Before(until) {
+			continue
+		}
+		ret = append(ret, event)
+	}
+	return ret
+}
+
+// parseTimeParam parses a time range bound: either an RFC 3339 timestamp, or a
+// duration such as 24h that is counted back from now.
+func parseTimeParam(r *http.Request, name string, now time.Time) (time.Time, error) {
+	raw := r.URL.Query().Get(name)
+	if raw == "" {
+		return time.Time{}, nil
+	}
+	if d, err := time.ParseDuration(raw); err == nil {
+		return now.Add(-d), nil
+	}
+	t, err := time.Parse(time.RFC3339, raw)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("%s: expected an RFC 3339 time or a duration, got %q", name, raw)
+	}
+	return t, nil
+}
+
+// historyRange reads the since and until query parameters; see
+// parseTimeParam.
+func historyRange(w http.ResponseWriter, r *http.Request) (since, until time.Time, ok bool) {
+	now := time.Now()
+	var err error
+	if since, err = parseTimeParam(r, "since", now); err == nil {
+		until, err = parseTimeParam(r, "until", now)
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return since, until, false
+	}
+	return since, until, true
+}
+
+// Handle /api/v1/history HTTP request: the transitions of the issues, newest
+// first, optionally limited to the ?since= and ?until= range.
+func historyAPIHandler(w http.ResponseWriter, r *http.Request) {
+	since, until, ok := historyRange(w, r)
+	if !ok {
+		return
+	}
+	writeJSON(w, historyBetween(since, until))
+}
+
+var historyTemplate = template.Must(template.New("history").Parse(`
+<html>
+    <head>
+        <title>irma watchdog history</title>
+        <style>
+        body {
+            color: white;
+            background-color: black;
+            font-family: Open Sans,Helvetica,Arial,sans-serif;
+            font-size: smaller;
+        }
+        td { padding-right: 1em; vertical-align: top; }
+        .new.danger { color: #e33; }
+        .new.warning { color: #fb3; }
+        .fixed { color: #3c3; }
+        </style>
+    </head>
+    <body>
+        <table>
+        {{ range . }}
+            <tr class="{{ .Event }} {{ .Severity }}">
+                <td>{{ .Time.Format "2006-01-02 15:04:05 MST" }}</td>
+                <td>{{ .Event }}</td>
+                <td>{{ .Severity }}</td>
+                <td>{{ .Message }}</td>
+            </tr>
+        {{ else }}
+            <tr><td>Nothing happened.</td></tr>
+        {{ end }}
+        </table>
+        <p><a href="/">Current status</a></p>
+    </body>
+</html>`))
+
+// Handle /history HTTP request: the HTML counterpart of /api/v1/history.
+func historyHandler(w http.ResponseWriter, r *http.Request) {
+	since, until, ok := historyRange(w, r)
+	if !ok {
+		return
+	}
+	if err := historyTemplate.Execute(w, historyBetween(since, until)); err != nil {
+		log.Printf("Error executing template: %s", err)
+	}
+}
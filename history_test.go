@@ -0,0 +1,93 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func resetHistory() {
+	historyMu.Lock()
+	history = nil
+	historyMu.Unlock()
+}
+
+func TestRecordHistoryPersistsAndBounds(t *testing.T) {
+	resetHistory()
+	defer resetHistory()
+	oldConf := conf
+	defer func() { conf = oldConf }()
+	conf.HistoryFile = filepath.Join(t.TempDir(), "history.jsonl")
+	conf.HistoryLimit = 10
+
+	start := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	for i := 0; i < 12; i++ {
+		recordHistory(issueEntries{issue("down")}, nil, start.Add(time.Duration(i)*time.Minute))
+	}
+	historyMu.RLock()
+	n := len(history)
+	historyMu.RUnlock()
+	if n > 10 {
+		t.Errorf("history grew beyond its limit: %d events", n)
+	}
+
+	// Simulate a restart.
+	resetHistory()
+	if err := loadHistory(conf.HistoryFile); err != nil {
+		t.Fatalf("loadHistory: %s", err)
+	}
+	events := historyBetween(time.Time{}, time.Time{})
+	if len(events) != n {
+		t.Fatalf("restored %d events, want %d", len(events), n)
+	}
+	if want := start.Add(11 * time.Minute); !events[0].Time.Equal(want) || events[0].Event != eventNew {
+		t.Errorf("newest event = %+v, want a new issue at %s", events[0], want)
+	}
+}
+
+// TestRecordHistoryKeepsNewestEvent: trimming a tiny history must not empty it.
+func TestRecordHistoryKeepsNewestEvent(t *testing.T) {
+	resetHistory()
+	defer resetHistory()
+	oldConf := conf
+	defer func() { conf = oldConf }()
+	conf.HistoryFile = ""
+	conf.HistoryLimit = 1
+
+	now := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	recordHistory(issueEntries{issue("down")}, nil, now)
+	recordHistory(nil, issueEntries{issue("down")}, now.Add(time.Minute))
+	events := historyBetween(time.Time{}, time.Time{})
+	if len(events) != 1 || events[0].Event != eventFixed {
+		t.Errorf("expected only the newest event to be kept, got %+v", events)
+	}
+}
+
+func TestHistoryAPIHandlerFiltersTimeRange(t *testing.T) {
+	resetHistory()
+	defer resetHistory()
+
+	start := time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC)
+	recordHistory(issueEntries{issue("down")}, nil, start)
+	recordHistory(nil, issueEntries{issue("down")}, start.Add(2*time.Hour))
+	recordHistory(issueEntries{issue("expiring")}, nil, start.Add(4*time.Hour))
+
+	rec := httptest.NewRecorder()
+	historyAPIHandler(rec, httptest.NewRequest(http.MethodGet, "/api/v1/history?since=2024-01-02T01:00:00Z&until=2024-01-02T03:00:00Z", nil))
+	var got []historyEvent
+	if err := json.NewDecoder(rec.Body).Decode(&got); err != nil {
+		t.Fatalf("decode response: %s", err)
+	}
+	if len(got) != 1 || got[0].Event != eventFixed || got[0].Message != "down" {
+		t.Errorf("expected only the fix of down, got %+v", got)
+	}
+
+	rec = httptest.NewRecorder()
+	historyAPIHandler(rec, httptest.NewRequest(http.MethodGet, "/api/v1/history?since=yesterday", nil))
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("status = %d for an invalid since, want 400", rec.Code)
+	}
+}
@@ -1,15 +1,69 @@
 package main
 
+import "time"
+
 type issueType int
 
+// Severities, from low to high. info is below zero so that the values of the
+// others, which are persisted in the state file, stay the same.
 const (
-	warning issueType = iota
+	info issueType = iota - 1 // worth knowing, but nothing has to be done yet
+	warning
 	danger
 )
 
+func (t issueType) String() string {
+	switch t {
+	case danger:
+		return "danger"
+	case info:
+		return "info"
+	default:
+		return "warning"
+	}
+}
+
+// checkKind names the kind of check that produced an issue.
+type checkKind string
+
+const (
+	kindSchemeManager checkKind = "schememanager"
+	kindCertificate   checkKind = "certificate"
+	kindAtum          checkKind = "atum"
+	kindHealthCheck   checkKind = "healthcheck"
+	kindScripted      checkKind = "scripted"
+	kindSession       checkKind = "session"
+	kindKeyshare      checkKind = "keyshare"
+	kindTLS           checkKind = "tls"
+	kindCT            checkKind = "ct"
+	kindDNS           checkKind = "dns"
+)
+
 type issueEntry struct {
 	issueType issueType
 	message   string
+
+	kind      checkKind
+	target    string // URL (or other identifier) of the checked resource, if any
+	condition string // what is wrong with the target, e.g. "unreachable"; see id
+
+	// Maintained by confirmIssues: when the issue was first detected in the
+	// current streak, and the last cycle it was still present.
+	firstSeen time.Time
+	lastSeen  time.Time
+	wasDanger bool // confirmed as danger at some point, so its recovery is paged too
+}
+
+// id identifies the issue across cycles: the check, its target and the
+// condition found. Unlike the message, which may carry details that change
+// while the issue persists (such as the days left until a certificate
+// expires), it is stable for as long as the issue is open. Issues that don't
+// name a condition are identified by their message.
+func (issue issueEntry) id() string {
+	if issue.condition == "" {
+		return issue.message
+	}
+	return string(issue.kind) + "|" + issue.target + "|" + issue.condition
 }
 
 type issueEntries []issueEntry
@@ -30,3 +84,23 @@ func (il issueEntries) filter(t issueType) (filtered []string) {
 	}
 	return
 }
+
+// except returns the issues of the checks that are not in targets.
+func (il issueEntries) except(targets map[checkTarget]bool) (kept issueEntries) {
+	for _, issue := range il {
+		if !targets[checkTarget{issue.kind, issue.target}] {
+			kept = append(kept, issue)
+		}
+	}
+	return
+}
+
+// tag sets the check kind and target on every entry, so that individual
+// checks don't have to repeat them in every issue they report.
+func (il issueEntries) tag(kind checkKind, target string) issueEntries {
+	for i := range il {
+		il[i].kind = kind
+		il[i].target = target
+	}
+	return il
+}
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"slices"
+	"time"
+)
+
+// signatureHeader carries the HMAC-SHA256 of the request body, keyed with the
+// secret of the webhook, so that the receiver can tell the watchdog's events
+// from forgeries.
+const signatureHeader = "X-Watchdog-Signature"
+
+// eventType says what happened to the issue in a webhook event.
+type eventType string
+
+const (
+	eventNew      eventType = "new"
+	eventFixed    eventType = "fixed"
+	eventReminder eventType = "reminder"
+	eventChange   eventType = "change" // of the contents of a scheme; see schemeChange
+)
+
+// JSONWebHook is a webhook that receives every event as a JSON document in the
+// body of a POST request.
+type JSONWebHook struct {
+	URL        string
+	Headers    map[string]string // added to every request, e.g. for authorization
+	Secret     string            // if set, requests are signed; see signatureHeader
+	Severities []string          // only deliver events of these severities; all if empty
+}
+
+// wants reports whether the webhook is interested in events of severity.
+func (hook JSONWebHook) wants(severity string) bool {
+	return len(hook.Severities) == 0 || slices.Contains(hook.Severities, severity)
+}
+
+// webHookEvent is the body of a JSON webhook request.
+type webHookEvent struct {
+	Event eventType `json:"event"`
+	apiIssue
+	Timestamp time.Time `json:"timestamp"`
+}
+
+func newWebHookEvents(event eventType, il issueEntries, now time.Time) []webHookEvent {
+	events := make([]webHookEvent, len(il))
+	for i, issue := range il {
+		events[i] = webHookEvent{
+			Event:     event,
+			apiIssue:  newAPIIssue(issue),
+			Timestamp: now,
+		}
+	}
+	return events
+}
+
+func pushToJSONWebHooks(c Conf, events []webHookEvent) {
+	for _, event := range events {
+		for _, hook := range c.JSONWebHooks {
+			if !hook.wants(event.Severity) {
+				continue
+			}
+			// As with pushToWebHooks, a failing endpoint must not hold up the others.
+			recordNotification("jsonwebhook", sendJSONWebHook(hook, event))
+		}
+	}
+}
+
+// sendJSONWebHook posts a single event to hook and reports whether it was
+// accepted.
+func sendJSONWebHook(hook JSONWebHook, event webHookEvent) bool {
+	body, err := json.Marshal(event)
+	if err != nil {
+		log.Printf("Webhook %s: %s", redactURL(hook.URL), err)
+		return false
+	}
+	req, err := http.NewRequest(http.MethodPost, hook.URL, bytes.NewReader(body))
+	if err != nil {
+		log.Printf("Webhook %s: %s", redactURL(hook.URL), redactErr(err, hook.URL))
+		return false
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for key, value := range hook.Headers {
+		req.Header.Set(key, value)
+	}
+	if hook.Secret != "" {
+		req.Header.Set(signatureHeader, "sha256="+sign(hook.Secret, body))
+	}
+
+	res, err := webHookClient.Do(req)
+	if err != nil {
+		log.Printf("Webhook %s: %s", redactURL(hook.URL), redactErr(err, hook.URL))
+		return false
+	}
+	defer res.Body.Close()
+	resBody, _ := io.ReadAll(res.Body)
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		log.Printf("Webhook %s: unexpected status %s: %s", redactURL(hook.URL), res.Status, truncateForLog(string(resBody)))
+		return false
+	}
+	return true
+}
+
+// sign returns the hex encoded HMAC-SHA256 of body keyed with secret.
+func sign(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func validateJSONWebHook(hook JSONWebHook) error {
+	if err := validateURL("jsonwebhooks", hook.URL); err != nil {
+		return err
+	}
+	for _, s := range hook.Severities {
+		if s != warning.String() && s != danger.String() && s != info.String() {
+			return fmt.Errorf("jsonwebhooks: %s: unknown severity %q", redactURL(hook.URL), s)
+		}
+	}
+	return nil
+}
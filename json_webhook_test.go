@@ -0,0 +1,110 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestSendJSONWebHookPostsSignedEvent(t *testing.T) {
+	var (
+		mu        sync.Mutex
+		got       map[string]any
+		body      []byte
+		signature string
+		auth      string
+	)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		if r.Method != http.MethodPost {
+			t.Errorf("method = %s, want POST", r.Method)
+		}
+		body, _ = io.ReadAll(r.Body)
+		signature = r.Header.Get(signatureHeader)
+		auth = r.Header.Get("Authorization")
+	}))
+	defer srv.Close()
+
+	hook := JSONWebHook{URL: srv.URL, Secret: "s3cret", Headers: map[string]string{"Authorization": "Bearer token"}}
+	issue := issueEntry{issueType: danger, message: "https://yivi.app: cannot be reached", kind: kindHealthCheck, target: "https://yivi.app", condition: "unreachable"}
+	events := newWebHookEvents(eventNew, issueEntries{issue}, time.Now())
+	if !sendJSONWebHook(hook, events[0]) {
+		t.Fatalf("sendJSONWebHook failed")
+	}
+	mu.Lock()
+	defer mu.Unlock()
+
+	if err := json.Unmarshal(body, &got); err != nil {
+		t.Fatalf("body is not JSON: %s", err)
+	}
+	for key, want := range map[string]any{
+		"event":    "new",
+		"id":       issue.id(),
+		"severity": "danger",
+		"message":  issue.message,
+		"check":    "healthcheck",
+	} {
+		if got[key] != want {
+			t.Errorf("%s = %v, want %v", key, got[key], want)
+		}
+	}
+	if want := "sha256=" + sign("s3cret", body); signature != want {
+		t.Errorf("signature = %q, want %q", signature, want)
+	}
+	if auth != "Bearer token" {
+		t.Errorf("configured header not sent, Authorization = %q", auth)
+	}
+}
+
+func TestSendJSONWebHookReportsErrorStatus(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer srv.Close()
+
+	events := newWebHookEvents(eventFixed, issueEntries{issue("boom")}, time.Now())
+	if sendJSONWebHook(JSONWebHook{URL: srv.URL}, events[0]) {
+		t.Errorf("expected a 500 response to count as a failed delivery")
+	}
+}
+
+func TestPushToJSONWebHooksFiltersSeverity(t *testing.T) {
+	var (
+		mu     sync.Mutex
+		events []string
+	)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		var event webHookEvent
+		json.NewDecoder(r.Body).Decode(&event)
+		events = append(events, event.Message)
+	}))
+	defer srv.Close()
+
+	oldConf := conf
+	defer func() { conf = oldConf }()
+	conf = Conf{JSONWebHooks: []JSONWebHook{{URL: srv.URL, Severities: []string{"danger"}}}}
+
+	pushToJSONWebHooks(conf, newWebHookEvents(eventNew, issueEntries{
+		{issueType: warning, message: "filtered"},
+		{issueType: danger, message: "delivered"},
+	}, time.Now()))
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(events) != 1 || events[0] != "delivered" {
+		t.Errorf("expected only the danger to be delivered, got %v", events)
+	}
+}
+
+func TestValidateJSONWebHookRejectsUnknownSeverity(t *testing.T) {
+	if err := validateJSONWebHook(JSONWebHook{URL: "https://example.com/hook", Severities: []string{"critical"}}); err == nil {
+		t.Errorf("expected an unknown severity to be rejected")
+	}
+}
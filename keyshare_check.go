@@ -0,0 +1,233 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/hashicorp/go-retryablehttp"
+	irma "github.com/privacybydesign/irmago"
+	"gopkg.in/yaml.v3"
+)
+
+// KeyshareCheck checks the keyshare server of a scheme, as configured in that
+// scheme. In the configuration it is either just the scheme identifier, or a
+// mapping with the scheme, a schedule and the URL at which the keyshare server
+// publishes its public key:
+//
+//	checkkeyshareservers:
+//	    - scheme: pbdf
+//	      publickey: https://keyshare.example/kss.pem
+//
+// The keyshare server itself has no endpoint for its public key, so without
+// publickey only the keys in the scheme are checked.
+type KeyshareCheck struct {
+	Scheme    string
+	PublicKey string // URL of the PEM encoded public key with which the keyshare server signs
+	Schedule  `yaml:",inline"`
+}
+
+func (c *KeyshareCheck) UnmarshalYAML(node *yaml.Node) error {
+	if node.Kind == yaml.ScalarNode {
+		return node.Decode(&c.Scheme)
+	}
+	type plain KeyshareCheck
+	return node.Decode((*plain)(c))
+}
+
+// keyshareProbeUser is the username of the authentication the check starts.
+// It should never be registered, so that a healthy keyshare server has to look
+// it up in its database and then refuse it.
+const keyshareProbeUser = "irma-watchdogd-probe"
+
+// checkKeyshareServer checks that the keyshare configuration of the scheme is
+// complete, and that the keyshare server answers the keyshare protocol. The
+// keyshare server signs its responses to the app with one of the keys of the
+// scheme, so those have to be valid RSA keys, and the key the keyshare server
+// publishes, if it does, has to be one of them.
+func checkKeyshareServer(ctx context.Context, client *retryablehttp.Client, irmaConfig *irma.Configuration, check KeyshareCheck) (ret issueEntries) {
+	id := check.Scheme
+	schemeMu.Lock()
+	if ctx.Err() != nil {
+		schemeMu.Unlock()
+		return
+	}
+	scheme := irmaConfig.SchemeManagers[irma.NewSchemeManagerIdentifier(id)]
+	var (
+		kss     string
+		keys    []*rsa.PublicKey
+		keyErr  error
+		attrErr error
+	)
+	if scheme != nil {
+		kss = scheme.KeyshareServer
+		keys, keyErr = keyshareServerKeys(irmaConfig, id)
+		attrErr = checkKeyshareAttribute(irmaConfig, scheme.KeyshareAttribute)
+	}
+	schemeMu.Unlock()
+
+	if scheme == nil {
+		return append(ret, issueEntry{issueType: danger, condition: "not-installed", message: fmt.Sprintf("%s: keyshare: scheme is not installed", id)})
+	}
+	if kss == "" {
+		return append(ret, issueEntry{issueType: danger, condition: "no-keyshare", message: fmt.Sprintf("%s: keyshare: scheme has no keyshare server", id)})
+	}
+	log.Printf(" checking keyshare server %s", kss)
+	if keyErr != nil {
+		ret = append(ret, issueEntry{issueType: danger, condition: "keys", message: fmt.Sprintf("%s: keyshare: %s", id, keyErr)})
+	} else if len(keys) == 0 {
+		ret = append(ret, issueEntry{issueType: danger, condition: "keys", message: fmt.Sprintf("%s: keyshare: scheme has no keyshare server public key", id)})
+	} else if check.PublicKey != "" {
+		if err := checkPublishedKeyshareKey(ctx, client, check.PublicKey, keys); err != nil {
+			ret = append(ret, issueEntry{issueType: danger, condition: "published-key", message: fmt.Sprintf("%s: keyshare: %s: %s", id, check.PublicKey, err)})
+		}
+	}
+	if attrErr != nil {
+		ret = append(ret, issueEntry{issueType: danger, condition: "keyshare-attribute", message: fmt.Sprintf("%s: keyshare: %s", id, attrErr)})
+	}
+
+	if err := probeKeyshareServer(ctx, client, kss); err != nil {
+		ret = append(ret, issueEntry{issueType: danger, condition: "protocol", message: fmt.Sprintf("%s: keyshare server %s: %s", id, kss, err)})
+	}
+	return
+}
+
+// keyshareServerKeys reads the public keys kss-0.pem, kss-1.pem, ... of the
+// keyshare server from the scheme.
+func keyshareServerKeys(irmaConfig *irma.Configuration, id string) (keys []*rsa.PublicKey, err error) {
+	for i := 0; ; i++ {
+		name := fmt.Sprintf("kss-%d.pem", i)
+		buf, err := os.ReadFile(filepath.Join(irmaConfig.Path, id, name))
+		if errors.Is(err, os.ErrNotExist) {
+			return keys, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		rsaKey, err := parseKeyshareKey(buf)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", name, err)
+		}
+		if rsaKey.N.BitLen() < 2048 {
+			return nil, fmt.Errorf("%s is only %d bits", name, rsaKey.N.BitLen())
+		}
+		keys = append(keys, rsaKey)
+	}
+}
+
+func parseKeyshareKey(buf []byte) (*rsa.PublicKey, error) {
+	block, _ := pem.Decode(buf)
+	if block == nil {
+		return nil, errors.New("not PEM encoded")
+	}
+	pk, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+	rsaKey, ok := pk.(*rsa.PublicKey)
+	if !ok {
+		return nil, errors.New("not an RSA key")
+	}
+	return rsaKey, nil
+}
+
+// checkPublishedKeyshareKey fetches the public key that the keyshare server
+// publishes at url, and checks that it is one of the keys of the scheme: if not,
+// the app rejects what the keyshare server signs.
+func checkPublishedKeyshareKey(ctx context.Context, client *retryablehttp.Client, url string, keys []*rsa.PublicKey) error {
+	req, err := retryablehttp.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+	res, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected status %s", res.Status)
+	}
+	buf, err := io.ReadAll(io.LimitReader(res.Body, 64<<10))
+	if err != nil {
+		return err
+	}
+	published, err := parseKeyshareKey(buf)
+	if err != nil {
+		return fmt.Errorf("published key: %w", err)
+	}
+	if !slices.ContainsFunc(keys, func(key *rsa.PublicKey) bool { return key.Equal(published) }) {
+		return errors.New("published key is none of the keyshare server keys of the scheme")
+	}
+	return nil
+}
+
+// checkKeyshareAttribute checks that the attribute in which the keyshare
+// server issues the username to the app exists.
+func checkKeyshareAttribute(irmaConfig *irma.Configuration, attr string) error {
+	if attr == "" {
+		return nil
+	}
+	if _, ok := irmaConfig.AttributeTypes[irma.NewAttributeTypeIdentifier(attr)]; !ok {
+		return fmt.Errorf("keyshare attribute %s does not exist", attr)
+	}
+	return nil
+}
+
+// probeKeyshareServer starts an authentication of a user that does not exist,
+// as the app does. The only healthy answer is that the user is not registered:
+// it means the request reached the keyshare server, which could look the user
+// up.
+func probeKeyshareServer(ctx context.Context, client *retryablehttp.Client, kss string) error {
+	// The keyshare server reads the username from the JWT before it verifies
+	// it with the key of the user, which this user does not have.
+	sk, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return err
+	}
+	authJWT, err := jwt.NewWithClaims(jwt.SigningMethodES256, irma.KeyshareAuthRequestClaims{Username: keyshareProbeUser}).SignedString(sk)
+	if err != nil {
+		return err
+	}
+	body, err := json.Marshal(irma.KeyshareAuthRequest{AuthRequestJWT: authJWT})
+	if err != nil {
+		return err
+	}
+
+	req, err := retryablehttp.NewRequestWithContext(ctx, http.MethodPost, strings.TrimSuffix(kss, "/")+"/users/verify_start", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	res, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	if res.StatusCode == http.StatusOK {
+		return fmt.Errorf("unregistered user %s was accepted", keyshareProbeUser)
+	}
+	var remote irma.RemoteError
+	if err := json.NewDecoder(io.LimitReader(res.Body, 64<<10)).Decode(&remote); err != nil || remote.ErrorName == "" {
+		return fmt.Errorf("unexpected status %s", res.Status)
+	}
+	if remote.ErrorName == "USER_NOT_REGISTERED" {
+		return nil
+	}
+	return fmt.Errorf("%s (status %d): %s", remote.ErrorName, res.StatusCode, remote.Description)
+}
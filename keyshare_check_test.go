@@ -0,0 +1,116 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/hashicorp/go-retryablehttp"
+	irma "github.com/privacybydesign/irmago"
+)
+
+// newKeyshareConfig returns a configuration with a scheme "test" whose keyshare
+// server is kss, and the PEM encoded keyshare server key of the scheme.
+func newKeyshareConfig(t *testing.T, kss string, bits int) (*irma.Configuration, []byte) {
+	dir := t.TempDir()
+	if err := os.Mkdir(filepath.Join(dir, "test"), 0o700); err != nil {
+		t.Fatal(err)
+	}
+	sk, err := rsa.GenerateKey(rand.Reader, bits)
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, err := x509.MarshalPKIXPublicKey(&sk.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pk := pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der})
+	if err := os.WriteFile(filepath.Join(dir, "test", "kss-0.pem"), pk, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return &irma.Configuration{
+		Path: dir,
+		SchemeManagers: map[irma.SchemeManagerIdentifier]*irma.SchemeManager{
+			irma.NewSchemeManagerIdentifier("test"): {ID: "test", KeyshareServer: kss},
+		},
+	}, pk
+}
+
+// newKeyshareClient returns a client that does not retry, so that failures
+// are reported at once.
+func newKeyshareClient() *retryablehttp.Client {
+	client := newHTTPClient()
+	client.RetryMax = 0
+	return client
+}
+
+func TestCheckKeyshareServer(t *testing.T) {
+	status := http.StatusForbidden
+	var published []byte
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/kss.pem" {
+			w.Write(published)
+			return
+		}
+		if r.URL.Path != "/api/v1/users/verify_start" {
+			http.NotFound(w, r)
+			return
+		}
+		w.WriteHeader(status)
+		if status == http.StatusForbidden {
+			w.Write([]byte(`{"error": "USER_NOT_REGISTERED", "status": 403, "description": "User is not yet fully registered"}`))
+		}
+	}))
+	defer srv.Close()
+
+	irmaConfig, pk := newKeyshareConfig(t, srv.URL+"/api/v1", 2048)
+	check := KeyshareCheck{Scheme: "test", PublicKey: srv.URL + "/kss.pem"}
+	published = pk
+	if issues := checkKeyshareServer(context.Background(), newKeyshareClient(), irmaConfig, check); len(issues) != 0 {
+		t.Errorf("expected no issues, got %+v", issues)
+	}
+
+	_, published = newKeyshareConfig(t, srv.URL, 2048)
+	issues := checkKeyshareServer(context.Background(), newKeyshareClient(), irmaConfig, check)
+	if len(issues) != 1 || issues[0].issueType != danger || issues[0].condition != "published-key" {
+		t.Errorf("expected a published key issue, got %+v", issues)
+	}
+
+	status = http.StatusBadGateway
+	issues = checkKeyshareServer(context.Background(), newKeyshareClient(), irmaConfig, KeyshareCheck{Scheme: "test"})
+	if len(issues) != 1 || issues[0].issueType != danger || issues[0].condition != "protocol" {
+		t.Errorf("expected a protocol issue, got %+v", issues)
+	}
+
+	if issues := checkKeyshareServer(context.Background(), newKeyshareClient(), irmaConfig, KeyshareCheck{Scheme: "other"}); len(issues) != 1 || issues[0].condition != "not-installed" {
+		t.Errorf("expected a missing scheme, got %+v", issues)
+	}
+}
+
+func TestCheckKeyshareServerRejectsInvalidConfiguration(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusForbidden)
+		w.Write([]byte(`{"error": "USER_NOT_REGISTERED", "status": 403}`))
+	}))
+	defer srv.Close()
+
+	irmaConfig, _ := newKeyshareConfig(t, srv.URL, 1024)
+	issues := checkKeyshareServer(context.Background(), newKeyshareClient(), irmaConfig, KeyshareCheck{Scheme: "test"})
+	if len(issues) != 1 || issues[0].condition != "keys" {
+		t.Errorf("expected a keys issue, got %+v", issues)
+	}
+
+	irmaConfig, _ = newKeyshareConfig(t, srv.URL, 2048)
+	irmaConfig.SchemeManagers[irma.NewSchemeManagerIdentifier("test")].KeyshareAttribute = "test.keyshare.account.username"
+	issues = checkKeyshareServer(context.Background(), newKeyshareClient(), irmaConfig, KeyshareCheck{Scheme: "test"})
+	if len(issues) != 1 || issues[0].condition != "keyshare-attribute" {
+		t.Errorf("expected a keyshare attribute issue, got %+v", issues)
+	}
+}
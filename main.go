@@ -8,6 +8,7 @@ package main
 
 import (
 	"context"
+	"crypto/x509"
 	"flag"
 	"fmt"
 	"html/template"
@@ -18,16 +19,17 @@ import (
 	"net/url"
 	"os"
 	"path"
+	"slices"
 	"strings"
 	"sync"
 	"time"
 
 	"github.com/hashicorp/go-retryablehttp"
 	irma "github.com/privacybydesign/irmago"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 
 	"github.com/ashwanthkumar/slack-go-webhook"
 	"github.com/dustin/go-humanize"
-	"gopkg.in/yaml.v3"
 
 	"github.com/bwesterb/go-atum"
 )
@@ -64,7 +66,16 @@ var rawTemplate string = `
             <li>Everything is ok!</li>
         {{ end }}
         </ul>
-        <p>Last update {{ .LastCheck }}</p>
+        {{ with .Uptime }}
+        <table>
+            <tr><th>Availability</th>{{ range (index . 0).Windows }}<th>{{ .Window }}</th>{{ end }}</tr>
+            {{ range . }}
+            <tr><td>{{ .Target }}</td>{{ range .Windows }}<td>{{ . }}</td>{{ end }}</tr>
+            {{ end }}
+        </table>
+        <p><a href="/api/v1/uptime.csv">Download as CSV</a></p>
+        {{ end }}
+        <p>Last update {{ .LastCheck }} (<a href="/history">history</a>)</p>
         <script type="text/javascript">
             setTimeout(function() {
                 window.location.reload(1);
@@ -75,6 +86,7 @@ var rawTemplate string = `
 
 type templateContext struct {
 	Issues    []string
+	Uptime    []uptimeReport
 	Interval  int
 	LastCheck string
 }
@@ -83,18 +95,18 @@ type templateContext struct {
 var (
 	conf           Conf
 	ticker         *time.Ticker
-	initialCheck   bool
 	parsedTemplate *template.Template
 
-	// Cross-cycle debounce state, keyed by issue message. failureStreaks/
+	// Cross-cycle debounce state, keyed by issue id. failureStreaks/
 	// recoveryStreaks count consecutive cycles an issue is present/absent;
 	// confirmedSet is the reported set that new/fixed alerts diff against.
 	failureStreaks  = map[string]int{}
 	recoveryStreaks = map[string]int{}
 	confirmedSet    = map[string]issueEntry{}
 
-	// cycleCount drives the initialCheck window (see runChecks).
-	cycleCount int
+	// pendingSet holds the issues that are present but not yet confirmed, with
+	// firstSeen set to when they were first detected.
+	pendingSet = map[string]issueEntry{}
 
 	// stateMu guards the mutable state shared between the background check
 	// goroutine (writer) and the HTTP handler (reader). Without it the handler
@@ -122,25 +134,37 @@ func currentState() (issueEntries, time.Time) {
 
 // Configuration
 type Conf struct {
-	CheckSchemeManagers    map[string]string // {url: pk}
-	BindAddr               string            // port to bind to
-	CheckCertificateExpiry []string
-	CheckAtumServers       []string
+	CheckSchemeManagers    map[string]SchemeCheck // by scheme URL
+	BindAddr               string                 // port to bind to
+	CheckCertificateExpiry []URLCheck
+	CertificateExpiry      ExpiryHorizons          // when to report expiring certificates, unless a check overrides it
+	KeyExpiry              ExpiryHorizons          // when to report expiring issuer public keys, unless a scheme overrides it
+	CheckTLS               []URLCheck              // hosts whose TLS configuration is inspected
+	CheckCT                CertificateTransparency // domains whose issued certificates are monitored
+	CheckDNS               []DNSCheck
+	CheckAtumServers       []URLCheck
+	CheckKeyshareServers   []KeyshareCheck
 	HealthChecks           []HealthCheck
-	Interval               time.Duration
+	ScriptedChecks         []ScriptedCheck
+	SessionChecks          []SessionCheck
+	Interval               time.Duration // default interval of the checks; see Schedule
+	Concurrency            int           // maximum number of checks running at the same time
+	CycleTimeout           time.Duration // deadline for a complete check cycle; defaults to the tick (see cycleTimeout)
+	StateFile              string        // if set, debounce state is persisted here across restarts
 	SlackWebhooks          []string
-	WebHooks               []string
-	FailureThreshold       int // consecutive cycles an issue must persist (or be absent) before it is reported new (or fixed)
+	WebHooks               []string      // URL templates, "%s" is replaced by the message of a new danger
+	FixedWebHooks          []string      // URL templates for fixed dangers; defaults to WebHooks
+	JSONWebHooks           []JSONWebHook // receive new and fixed issues as JSON POST requests
+	Alertmanagers          []string      // base URLs of Alertmanagers that receive the confirmed issues as alerts
+	Reminders              Reminders     // how often to announce issues that stay open again
+	HistoryFile            string        // if set, new and fixed issues are logged here, one JSON event per line
+	HistoryLimit           int           // number of events the history keeps; defaults to defaultHistoryLimit
+	FailureThreshold       int           // consecutive runs of a check an issue must persist (or be absent) before it is reported new (or fixed)
 }
 
 func main() {
 	var confPath string
 
-	// set configuration defaults
-	conf.BindAddr = ":8080"
-	conf.Interval = 5 * time.Minute
-	conf.FailureThreshold = 3
-
 	// parse commandline
 	flag.StringVar(&confPath, "config", "config.yaml",
 		"Path to configuration file")
@@ -157,18 +181,9 @@ func main() {
 		log.Fatalf("Could not stat configuration file: %v", err)
 	}
 
-	buf, err := os.ReadFile(confPath)
-	if err != nil {
-		log.Fatalf("Could not read config file %s: %s", confPath, err)
-	}
-
-	if err := yaml.Unmarshal(buf, &conf); err != nil {
-		log.Fatalf("Could not parse config file: %s", err)
-	}
-
-	// Threshold 1 reproduces the old alert-immediately behaviour; lower is meaningless.
-	if conf.FailureThreshold < 1 {
-		conf.FailureThreshold = 1
+	var err error
+	if conf, err = loadConf(confPath); err != nil {
+		log.Fatalf("Could not load config file %s: %s", confPath, err)
 	}
 
 	// Load IRMA configuration
@@ -190,15 +205,36 @@ func main() {
 		log.Printf("IRMA configuration could not be loaded in temp dir %s: %s", icDir, err)
 		return
 	}
-	for url, pk := range conf.CheckSchemeManagers {
-		if err = irmaConfig.InstallScheme(url, []byte(pk)); err != nil {
+	for url, check := range conf.CheckSchemeManagers {
+		if err = irmaConfig.InstallScheme(url, []byte(check.PublicKey)); err != nil {
 			log.Printf("could not install scheme %s: %s", icDir, err)
 			return
 		}
 	}
 
+	if conf.StateFile != "" {
+		if err := loadState(conf.StateFile); err != nil {
+			log.Printf("Could not restore state from %s, starting afresh: %s", conf.StateFile, err)
+		} else {
+			// The configuration may have changed while we were down.
+			forgetRemovedChecks(checkJobs(irmaConfig))
+		}
+	}
+
+	if conf.HistoryFile != "" {
+		if err := loadHistory(conf.HistoryFile); err != nil {
+			log.Printf("Could not read history from %s: %s", conf.HistoryFile, err)
+		}
+	}
+
 	// set up HTTP server
 	http.HandleFunc("/", handler)
+	http.HandleFunc("/api/v1/status", statusHandler)
+	http.HandleFunc("/history", historyHandler)
+	http.HandleFunc("/api/v1/history", historyAPIHandler)
+	http.HandleFunc("/api/v1/uptime", uptimeHandler)
+	http.HandleFunc("/api/v1/uptime.csv", uptimeCSVHandler)
+	http.Handle("/metrics", promhttp.Handler())
 
 	// parse template
 	parsedTemplate, err = template.New("template").Parse(rawTemplate)
@@ -207,12 +243,24 @@ func main() {
 	}
 
 	log.Printf("Will check status every %s", conf.Interval)
-	ticker = time.NewTicker(conf.Interval)
+	ticker = time.NewTicker(tickInterval(checkJobs(irmaConfig)))
+	reload := watchConfig(confPath)
 
 	go func() {
 		for {
 			runChecks(irmaConfig)
-			<-ticker.C
+
+			// Reloads are applied between cycles, so a cycle never sees a
+			// mix of two configurations.
+		wait:
+			for {
+				select {
+				case <-ticker.C:
+					break wait
+				case <-reload:
+					reloadConf(confPath, irmaConfig)
+				}
+			}
 		}
 	}()
 
@@ -227,29 +275,31 @@ func handler(w http.ResponseWriter, r *http.Request) {
 	err := parsedTemplate.Execute(w, templateContext{
 		LastCheck: humanize.Time(when),
 		Issues:    curIssues.messages(),
-		Interval:  int(conf.Interval.Seconds() * 1000),
+		Uptime:    uptimeReports(time.Now()),
+		Interval:  int(currentConf().Interval.Seconds() * 1000),
 	})
 	if err != nil {
 		log.Printf("Error executing template: %s", err)
 	}
 }
 
-// Computes difference between old and new issues
+// Computes difference between old and new issues. An issue that is still
+// there but got more severe, such as a certificate that is about to expire, is
+// new again: it is announced at its new severity, without announcing it fixed.
 func difference(old, cur issueEntries) (came, gone issueEntries) {
-	lut := make(map[string]bool)
+	lut := make(map[string]issueType)
 	for _, x := range old {
-		lut[x.message] = true
+		lut[x.id()] = x.issueType
 	}
+	present := make(map[string]bool)
 	for _, x := range cur {
-		if _, ok := lut[x.message]; !ok {
+		present[x.id()] = true
+		if prev, ok := lut[x.id()]; !ok || x.issueType > prev {
 			came = append(came, x)
-		} else {
-			lut[x.message] = false
 		}
 	}
 	for _, x := range old {
-		isGone := lut[x.message]
-		if isGone {
+		if !present[x.id()] {
 			gone = append(gone, x)
 		}
 	}
@@ -257,37 +307,105 @@ func difference(old, cur issueEntries) (came, gone issueEntries) {
 }
 
 func runChecks(irmaConfig *irma.Configuration) {
-	var curIssues issueEntries
+	start := time.Now()
+	jobs := checkJobs(irmaConfig)
+	tick := tickInterval(jobs)
 
-	// Keep initialCheck open for the first FailureThreshold cycles: a startup
-	// outage is only confirmed on cycle FailureThreshold, and must still be
-	// treated as a restart artefact (suppressed from webhooks) rather than new.
-	cycleCount++
-	initialCheck = cycleCount <= conf.FailureThreshold
+	due := dueJobs(jobs, start, tick)
 
-	log.Println("Running checks ...")
-	curIssues = append(curIssues, checkSchemeManagers(irmaConfig)...)
-	curIssues = append(curIssues, checkCertificateExpiry()...)
-	curIssues = append(curIssues, checkAtumServers()...)
-	curIssues = append(curIssues, runHealthChecks(conf.HealthChecks)...)
+	// Until a check could have confirmed an outage present at startup, its
+	// issues must still be treated as restart artefacts (suppressed from
+	// webhooks) rather than new.
+	initial := initialTargets(jobs)
+	log.Printf("Running %d of %d checks ...", len(due), len(jobs))
+
+	timeout := cycleTimeout(tick)
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	curIssues := runCheckJobs(ctx, conf.Concurrency, due)
+	cancel()
 
 	logCurrentIssues(curIssues.messages())
 
-	confirmedIssues := confirmIssues(curIssues)
+	// Checks that did not run this cycle keep their last outcome in the metrics.
+	ran := make(map[checkTarget]int, len(due))
+	for _, job := range due {
+		ran[job.checkTarget] = job.schedule.FailureThreshold
+		lastIssues[job.checkTarget] = nil
+	}
+	for _, issue := range curIssues {
+		target := checkTarget{issue.kind, issue.target}
+		lastIssues[target] = append(lastIssues[target], issue)
+	}
+	for _, job := range due {
+		if job.kind == kindHealthCheck {
+			up := !slices.ContainsFunc(lastIssues[job.checkTarget], func(issue issueEntry) bool {
+				return issue.issueType == danger || issue.condition == "deadline"
+			})
+			recordUptime(job.target, up, start, 2*job.schedule.Interval+timeout)
+		}
+	}
+	targets := make([]checkTarget, len(jobs))
+	var observed issueEntries
+	for i, job := range jobs {
+		targets[i] = job.checkTarget
+		observed = append(observed, lastIssues[job.checkTarget]...)
+	}
+	recordCheckMetrics(targets, observed)
+
+	confirmedIssues := confirmCheckedIssues(curIssues, ran)
 
 	prevIssues, _ := currentState()
 	newIssues, fixedIssues := difference(prevIssues, confirmedIssues)
+	now := time.Now()
+	recordHistory(newIssues, fixedIssues, now)
 
+	// The issues of checks that are still in their initial state are not sent
+	// to webhooks.
+	pagedNew, pagedFixed := newIssues.except(initial), fixedIssues.except(initial)
 	if len(conf.SlackWebhooks) > 0 {
-		go pushToSlack(newIssues, fixedIssues, initialCheck)
+		go pushToSlack(conf, newIssues, fixedIssues, len(pagedNew) < len(newIssues))
+	}
+	if len(conf.WebHooks)+len(conf.FixedWebHooks) > 0 {
+		go pushToWebHooks(conf, pagedNew, pagedFixed)
+	}
+	if len(conf.JSONWebHooks) > 0 {
+		events := append(newWebHookEvents(eventNew, pagedNew, now), newWebHookEvents(eventFixed, pagedFixed, now)...)
+		go pushToJSONWebHooks(conf, events)
+	}
+
+	if reminders := dueReminders(confirmedIssues, now).except(initial); len(reminders) > 0 {
+		if len(conf.SlackWebhooks) > 0 {
+			go pushRemindersToSlack(conf, reminders, len(confirmedIssues), now)
+		}
+		if len(conf.JSONWebHooks) > 0 {
+			go pushToJSONWebHooks(conf, newWebHookEvents(eventReminder, reminders, now))
+		}
+	}
+
+	// Changes to schemes are not issues, so they are announced right away.
+	if changes := takeSchemeChanges(); len(changes) > 0 {
+		if len(conf.SlackWebhooks) > 0 {
+			go pushSchemeChangesToSlack(conf, changes)
+		}
+		if len(conf.JSONWebHooks) > 0 {
+			go pushToJSONWebHooks(conf, newSchemeChangeEvents(changes, now))
+		}
 	}
 
-	// If this is an initial check, don't send the issues to webhooks
-	if len(conf.WebHooks) > 0 && !initialCheck {
-		go pushToWebHooks(newIssues)
+	// Alertmanager deduplicates, so it gets the complete state, initial or not.
+	if len(conf.Alertmanagers) > 0 {
+		ttl := 3 * max(tick, timeout)
+		go pushToAlertmanagers(conf, newAlerts(prevIssues, confirmedIssues, fixedIssues, now, ttl))
 	}
 
-	setState(confirmedIssues, time.Now())
+	setState(confirmedIssues, now)
+	recordCycleMetrics(start)
+
+	if conf.StateFile != "" {
+		if err := saveState(conf.StateFile); err != nil {
+			log.Printf("Could not save state to %s: %s", conf.StateFile, err)
+		}
+	}
 }
 
 // confirmIssues applies symmetric cross-cycle debouncing and returns the current
@@ -295,61 +413,105 @@ func runChecks(irmaConfig *irma.Configuration) {
 // consecutive cycles, and dropped once absent for that many, so transient blips
 // in either direction produce no alert churn. runChecks diffs the returned set
 // against the previous one to derive new/fixed alerts.
-func confirmIssues(curIssues issueEntries) (confirmed issueEntries) {
-	// De-duplicate per message so duplicate entries can't advance a streak twice.
+func confirmIssues(curIssues issueEntries) issueEntries {
+	return confirmCheckedIssues(curIssues, nil)
+}
+
+// confirmCheckedIssues is confirmIssues for a cycle in which only some checks
+// ran: ran maps those to their failure threshold. The streaks of checks that
+// did not run are left alone, as their absence from curIssues says nothing. A
+// nil ran means that all checks ran with the global threshold.
+func confirmCheckedIssues(curIssues issueEntries, ran map[checkTarget]int) (confirmed issueEntries) {
+	threshold := func(issue issueEntry) (int, bool) {
+		if ran == nil {
+			return conf.FailureThreshold, true
+		}
+		n, ok := ran[checkTarget{issue.kind, issue.target}]
+		return n, ok
+	}
+
+	// De-duplicate per id so duplicate entries can't advance a streak twice.
 	curEntries := make(map[string]issueEntry, len(curIssues))
 	var order []string
 	for _, issue := range curIssues {
-		if _, seen := curEntries[issue.message]; seen {
+		id := issue.id()
+		if _, seen := curEntries[id]; seen {
 			continue
 		}
-		curEntries[issue.message] = issue
-		order = append(order, issue.message)
+		curEntries[id] = issue
+		order = append(order, id)
 	}
 
 	var pending, recovering []string
+	now := time.Now()
 
 	// Present issues: reset recovery streak, advance failure streak, and confirm
 	// once the threshold is reached (refreshing already-confirmed entries).
-	for _, msg := range order {
-		delete(recoveryStreaks, msg)
-		if _, ok := confirmedSet[msg]; ok {
-			confirmedSet[msg] = curEntries[msg]
+	for _, id := range order {
+		delete(recoveryStreaks, id)
+		entry := curEntries[id]
+		entry.lastSeen = now
+		if prev, ok := confirmedSet[id]; ok {
+			entry.firstSeen = prev.firstSeen
+			entry.wasDanger = prev.wasDanger || entry.issueType == danger
+			confirmedSet[id] = entry
 			continue
 		}
-		failureStreaks[msg]++
-		if failureStreaks[msg] >= conf.FailureThreshold {
-			confirmedSet[msg] = curEntries[msg]
+		if prev, ok := pendingSet[id]; ok {
+			entry.firstSeen = prev.firstSeen
+		} else {
+			entry.firstSeen = now
+		}
+		n, ok := threshold(entry)
+		if !ok {
+			n = conf.FailureThreshold
+		}
+		failureStreaks[id]++
+		if failureStreaks[id] >= n {
+			delete(pendingSet, id)
+			entry.wasDanger = entry.issueType == danger
+			confirmedSet[id] = entry
 		} else {
-			pending = append(pending, fmt.Sprintf("%s (%d/%d)", msg, failureStreaks[msg], conf.FailureThreshold))
+			pendingSet[id] = entry
+			pending = append(pending, fmt.Sprintf("%s (%d/%d)", entry.message, failureStreaks[id], n))
 		}
 	}
 
 	// Unconfirmed and now absent: a blip that never reached the threshold; reset
 	// its failure streak so it counts from scratch if it returns.
-	for msg := range failureStreaks {
-		if _, present := curEntries[msg]; present {
+	for id := range failureStreaks {
+		if _, present := curEntries[id]; present {
 			continue
 		}
-		if _, ok := confirmedSet[msg]; ok {
+		if _, ok := confirmedSet[id]; ok {
 			continue
 		}
-		delete(failureStreaks, msg)
+		if entry, ok := pendingSet[id]; ok {
+			if _, checked := threshold(entry); !checked {
+				continue
+			}
+		}
+		delete(failureStreaks, id)
+		delete(pendingSet, id)
 	}
 
 	// Confirmed but now absent: advance the recovery streak and only drop (report
 	// fixed) once it reaches the threshold, mirroring the failure debounce.
-	for msg := range confirmedSet {
-		if _, present := curEntries[msg]; present {
+	for id, entry := range confirmedSet {
+		if _, present := curEntries[id]; present {
+			continue
+		}
+		n, checked := threshold(entry)
+		if !checked {
 			continue
 		}
-		recoveryStreaks[msg]++
-		if recoveryStreaks[msg] >= conf.FailureThreshold {
-			delete(confirmedSet, msg)
-			delete(failureStreaks, msg)
-			delete(recoveryStreaks, msg)
+		recoveryStreaks[id]++
+		if recoveryStreaks[id] >= n {
+			delete(confirmedSet, id)
+			delete(failureStreaks, id)
+			delete(recoveryStreaks, id)
 		} else {
-			recovering = append(recovering, fmt.Sprintf("%s (%d/%d)", msg, recoveryStreaks[msg], conf.FailureThreshold))
+			recovering = append(recovering, fmt.Sprintf("%s (%d/%d)", entry.message, recoveryStreaks[id], n))
 		}
 	}
 
@@ -362,13 +524,13 @@ func confirmIssues(curIssues issueEntries) (confirmed issueEntries) {
 
 	// Return the full confirmed set: current-cycle entries first (in detection
 	// order) for stable output, then recovering ones.
-	for _, msg := range order {
-		if entry, ok := confirmedSet[msg]; ok {
+	for _, id := range order {
+		if entry, ok := confirmedSet[id]; ok {
 			confirmed = append(confirmed, entry)
 		}
 	}
-	for msg, entry := range confirmedSet {
-		if _, present := curEntries[msg]; present {
+	for id, entry := range confirmedSet {
+		if _, present := curEntries[id]; present {
 			continue
 		}
 		confirmed = append(confirmed, entry)
@@ -382,17 +544,38 @@ func confirmIssues(curIssues issueEntries) (confirmed issueEntries) {
 // consistent with the retryablehttp client used elsewhere (see newHTTPClient).
 var webHookClient = &http.Client{Timeout: 10 * time.Second}
 
-func pushToWebHooks(newIssues issueEntries) {
-	dangers := newIssues.filter(danger)
-	for _, msg := range dangers {
-		for _, bareURL := range conf.WebHooks {
+// pushToWebHooks announces new and fixed dangers. Fixed ones go to the
+// FixedWebHooks templates if there are any, and to the WebHooks otherwise, so
+// that whoever was paged for an outage also hears about its recovery.
+func pushToWebHooks(c Conf, newIssues, fixedIssues issueEntries) {
+	fixedHooks := c.FixedWebHooks
+	if len(fixedHooks) == 0 {
+		fixedHooks = c.WebHooks
+	}
+	sendToWebHooks(c.WebHooks, "Watchdog: ", newIssues.filter(danger))
+	// Recoveries are paged for every issue that was paged, including those
+	// that became less severe before they were fixed.
+	var fixed []string
+	for _, issue := range fixedIssues {
+		if issue.issueType == danger || issue.wasDanger {
+			fixed = append(fixed, issue.message)
+		}
+	}
+	sendToWebHooks(fixedHooks, "Watchdog: fixed: ", fixed)
+}
+
+func sendToWebHooks(hooks []string, prefix string, messages []string) {
+	for _, msg := range messages {
+		for _, bareURL := range hooks {
 			// The configured webhook URL is a template containing a literal
 			// "%s" placeholder for the message. Substitute it directly instead
 			// of treating the operator-controlled URL as a fmt format string,
 			// which would misbehave on stray "%" characters and is a format
 			// string injection risk.
-			u := strings.Replace(bareURL, "%s", url.QueryEscape("Watchdog: "+msg), 1)
-			if !sendWebHook(u) {
+			u := strings.Replace(bareURL, "%s", url.QueryEscape(prefix+msg), 1)
+			ok := sendWebHook(u)
+			recordNotification("webhook", ok)
+			if !ok {
 				// Log and move on: a single unreachable or failing endpoint
 				// must not prevent delivery to the remaining webhooks (or the
 				// remaining alerts).
@@ -423,17 +606,19 @@ func sendWebHook(u string) bool {
 	return true
 }
 
-func pushToSlack(newIssues, fixedIssues issueEntries, initial bool) {
+func pushToSlack(c Conf, newIssues, fixedIssues issueEntries, initial bool) {
 	strGood := "good"
 	strWarning := "warning"
 	strBad := "bad"
+	strInfo := "#439FE0"
 	if len(newIssues) > 0 {
 		if initial {
-			pushMessageToSlack("I just (re)started, so I might repeat some known issues.", []slack.Attachment{})
+			pushMessageToSlack(c, "I just (re)started, so I might repeat some known issues.", []slack.Attachment{})
 		}
 
 		dangers := newIssues.filter(danger)
 		warnings := newIssues.filter(warning)
+		notices := newIssues.filter(info)
 
 		if len(dangers) > 0 {
 			// Add mention such that notifications for warnings can be suppressed.
@@ -447,7 +632,7 @@ func pushToSlack(newIssues, fixedIssues issueEntries, initial bool) {
 					Color:    &strBad,
 				})
 			}
-			pushMessageToSlack(message, attachments)
+			pushMessageToSlack(c, message, attachments)
 		}
 
 		if len(warnings) > 0 {
@@ -461,7 +646,21 @@ func pushToSlack(newIssues, fixedIssues issueEntries, initial bool) {
 					Color:    &strWarning,
 				})
 			}
-			pushMessageToSlack(message, attachments)
+			pushMessageToSlack(c, message, attachments)
+		}
+
+		if len(notices) > 0 {
+			message := "New notices."
+			var attachments []slack.Attachment
+			for _, msg := range notices {
+				msg := msg
+				attachments = append(attachments, slack.Attachment{
+					Fallback: &msg,
+					Text:     &msg,
+					Color:    &strInfo,
+				})
+			}
+			pushMessageToSlack(c, message, attachments)
 		}
 	}
 
@@ -476,12 +675,12 @@ func pushToSlack(newIssues, fixedIssues issueEntries, initial bool) {
 				Color:    &strGood,
 			})
 		}
-		pushMessageToSlack(message, attachments)
+		pushMessageToSlack(c, message, attachments)
 	}
 }
 
-func pushMessageToSlack(message string, attachments []slack.Attachment) {
-	for _, url := range conf.SlackWebhooks {
+func pushMessageToSlack(c Conf, message string, attachments []slack.Attachment) {
+	for _, url := range c.SlackWebhooks {
 		payload := slack.Payload{
 			Text:        message,
 			Username:    "irma-watchdogd",
@@ -492,8 +691,10 @@ func pushMessageToSlack(message string, attachments []slack.Attachment) {
 			// The Slack webhook URL embeds a secret token in its path, so only
 			// log a redacted form of it on failure.
 			log.Printf("SlackWebhook %s: %s", redactURL(url), redactErrs(err, url))
+			recordNotification("slack", false)
 			continue
 		}
+		recordNotification("slack", true)
 	}
 }
 
@@ -503,31 +704,25 @@ func logCurrentIssues(curIssues []string) {
 	}
 }
 
-func checkCertificateExpiry() (ret issueEntries) {
-	client := newHTTPClient()
-
-	issueEntriesChan := make(chan issueEntries, len(conf.CheckCertificateExpiry))
-
-	for _, check := range conf.CheckCertificateExpiry {
-		check := check
-		issueEntriesChan <- checkCertificateExpiryOf(client, check)
-	}
-
-	close(issueEntriesChan)
+func checkCertificateExpiryOf(ctx context.Context, client *retryablehttp.Client, url string, horizons ExpiryHorizons) (ret issueEntries) {
+	log.Printf(" checking certificate expiry on %s", url)
 
-	for entries := range issueEntriesChan {
-		ret = append(ret, entries...)
+	// Other than HTTPS, the certificates come straight from the handshake.
+	if !strings.HasPrefix(url, "https://") && !strings.HasPrefix(url, "http://") {
+		state, err := dialTLS(ctx, url)
+		if err != nil {
+			ret = append(ret, issueEntry{issueType: warning, condition: "unreachable", message: fmt.Sprintf("%s: error %s", url, err)})
+			return
+		}
+		return certificateExpiryIssues(url, state.PeerCertificates, horizons, time.Now())
 	}
 
-	return
-}
-
-func checkCertificateExpiryOf(client *retryablehttp.Client, url string) (ret issueEntries) {
-	log.Printf(" checking certificate expiry on %s", url)
+	// The hooks below are per check, so don't install them on the shared client.
+	client = forkHTTPClient(client)
 
-	req, err := retryablehttp.NewRequest(http.MethodHead, url, nil)
+	req, err := retryablehttp.NewRequestWithContext(ctx, http.MethodHead, url, nil)
 	if err != nil {
-		ret = append(ret, issueEntry{warning, fmt.Sprintf("%s: invalid certificate check: %s", url, err)})
+		ret = append(ret, issueEntry{issueType: warning, condition: "invalid", message: fmt.Sprintf("%s: invalid certificate check: %s", url, err)})
 		return
 	}
 
@@ -547,91 +742,217 @@ func checkCertificateExpiryOf(client *retryablehttp.Client, url string) (ret iss
 	}
 
 	resp, err := client.Do(req)
+	recordRequestPhases(kindCertificate, url, trace)
 	if err != nil {
-		ret = append(ret, issueEntry{warning, fmt.Sprintf("%s: error %s", url, err)})
+		ret = append(ret, issueEntry{issueType: warning, condition: "unreachable", message: fmt.Sprintf("%s: error %s", url, err)})
 		return
 	}
 	defer resp.Body.Close()
 	if resp.TLS == nil {
-		ret = append(ret, issueEntry{warning, fmt.Sprintf("%s: no TLS enabled", url)})
+		ret = append(ret, issueEntry{issueType: warning, condition: "no-tls", message: fmt.Sprintf("%s: no TLS enabled", url)})
 		return
 	}
 
-	for _, cert := range resp.TLS.PeerCertificates {
+	return certificateExpiryIssues(url, resp.TLS.PeerCertificates, horizons, time.Now())
+}
+
+// certificateExpiryIssues reports the certificates presented by url that
+// expire within horizons.
+func certificateExpiryIssues(url string, certs []*x509.Certificate, horizons ExpiryHorizons, now time.Time) (ret issueEntries) {
+	for _, cert := range certs {
+		recordCertificateExpiry(url, cert)
+		severity, ok := horizons.severity(cert.NotAfter, now)
+		if !ok {
+			continue
+		}
 		issuer := strings.Join(cert.Issuer.Organization, ", ")
-		daysExpired := int(time.Since(cert.NotAfter).Hours() / 24)
-		if daysExpired > 0 {
-			ret = append(ret, issueEntry{danger, fmt.Sprintf("%s: certificate from %s has expired %d days", url, issuer, daysExpired)})
-		} else if daysExpired > -30 {
-			ret = append(ret, issueEntry{warning, fmt.Sprintf("%s: certificate from %s will expire in %d days", url, issuer, -daysExpired)})
+		// The days in the message change daily; the certificate does not.
+		// Reaching the next tier, or expiring, is announced by difference.
+		serial := cert.SerialNumber.Text(16)
+		if !now.Before(cert.NotAfter) {
+			daysExpired := int(now.Sub(cert.NotAfter).Hours() / 24)
+			ret = append(ret, issueEntry{issueType: danger, condition: "expiry:" + serial, message: fmt.Sprintf("%s: certificate from %s has expired %d days", url, issuer, daysExpired)})
+		} else {
+			daysLeft := int(cert.NotAfter.Sub(now).Hours() / 24)
+			ret = append(ret, issueEntry{issueType: severity, condition: "expiry:" + serial, message: fmt.Sprintf("%s: certificate from %s will expire in %d days", url, issuer, daysLeft)})
 		}
 	}
 	return ret
 }
 
-func checkAtumServers() (ret issueEntries) {
-	for _, url := range conf.CheckAtumServers {
-		ret = append(ret, checkAtumServer(url)...)
+// atumTimeout bounds the requests to the Atum servers.
+const atumTimeout = 30 * time.Second
+
+// atumWaiting holds the Atum servers for which a stamp request of an earlier
+// check is still waiting. go-atum makes its requests with the default client,
+// which never gives up on a server that doesn't answer, and takes no context:
+// a check can stop waiting, but the request carries on in the background. It
+// is not repeated until it returns, so that they don't pile up.
+var (
+	atumMu      sync.Mutex
+	atumWaiting = map[string]bool{}
+)
+
+func checkAtumServer(ctx context.Context, url string) (ret issueEntries) {
+	log.Printf(" checking atum server %s", url)
+	atumMu.Lock()
+	if atumWaiting[url] {
+		atumMu.Unlock()
+		return append(ret, issueEntry{issueType: danger, condition: "deadline", message: fmt.Sprintf("%s: still waiting for the Atum stamp of an earlier check", url)})
+	}
+	atumWaiting[url] = true
+	atumMu.Unlock()
+
+	ctx, cancel := context.WithTimeout(ctx, atumTimeout)
+	defer cancel()
+	done := make(chan issueEntries, 1)
+	go func() {
+		defer func() {
+			atumMu.Lock()
+			delete(atumWaiting, url)
+			atumMu.Unlock()
+		}()
+		done <- requestAtumStamp(url)
+	}()
+	select {
+	case ret = <-done:
+		return ret
+	case <-ctx.Done():
+		return append(ret, issueEntry{issueType: danger, condition: "deadline", message: fmt.Sprintf("%s: no Atum stamp within %s", url, atumTimeout)})
 	}
-	return
 }
 
-func checkAtumServer(url string) (ret issueEntries) {
-	log.Printf(" checking atum server %s", url)
+// requestAtumStamp requests a timestamp from the Atum server at url, and
+// verifies it.
+func requestAtumStamp(url string) (ret issueEntries) {
 	ts, err := atum.JsonStamp(url, []byte{1, 2, 3, 4, 5})
 	if err != nil {
-		ret = append(ret, issueEntry{danger, fmt.Sprintf("%s: requesting Atum stamp failed: %s", url, err)})
+		ret = append(ret, issueEntry{issueType: danger, condition: "unreachable", message: fmt.Sprintf("%s: requesting Atum stamp failed: %s", url, err)})
 		return
 	}
 	valid, _, url2, err := atum.Verify(ts, []byte{1, 2, 3, 4, 5})
 	if err != nil {
-		ret = append(ret, issueEntry{danger, fmt.Sprintf("%s: failed to verify signature: %s", url, err)})
+		ret = append(ret, issueEntry{issueType: danger, condition: "bad-signature", message: fmt.Sprintf("%s: failed to verify signature: %s", url, err)})
 		return
 	}
 	if !valid {
-		ret = append(ret, issueEntry{danger, fmt.Sprintf("%s: timestamp invalid", url)})
+		ret = append(ret, issueEntry{issueType: danger, condition: "invalid-timestamp", message: fmt.Sprintf("%s: timestamp invalid", url)})
 		return
 	}
 	if url != url2 {
-		ret = append(ret, issueEntry{warning, fmt.Sprintf("%s: timestamp set for wrong url: %s", url, url2)})
+		ret = append(ret, issueEntry{issueType: warning, condition: "wrong-url", message: fmt.Sprintf("%s: timestamp set for wrong url: %s", url, url2)})
 		return
 	}
 	return
 }
 
-// The IRMA app keeps functioning when the scheme is down, so all issues that we find are warnings.
-func checkSchemeManagers(irmaConfig *irma.Configuration) (ret issueEntries) {
-	log.Printf(" checking schememanagers")
+// mentionsScheme reports whether warn names an identifier within the scheme
+// id, or its directory. The identifier must start at a word boundary, so that
+// "pbdf." does not match in "xpbdf.".
+func mentionsScheme(warn, id string) bool {
+	if strings.Contains(warn, "/"+id+"/") {
+		return true
+	}
+	for i := 0; ; i++ {
+		n := strings.Index(warn[i:], id+".")
+		if n < 0 {
+			return false
+		}
+		i += n
+		if i == 0 || !isIdentifierByte(warn[i-1]) {
+			return true
+		}
+	}
+}
+
+func isIdentifierByte(b byte) bool {
+	return b == '_' || b == '-' || '0' <= b && b <= '9' || 'a' <= b && b <= 'z' || 'A' <= b && b <= 'Z'
+}
+
+// schemeMu serializes the scheme checks: they share irmaConfig, and its
+// Warnings in particular.
+var schemeMu sync.Mutex
+
+// findScheme returns the installed scheme at url, and its identifier.
+func findScheme(irmaConfig *irma.Configuration, url string) (irma.Scheme, string) {
+	url = strings.TrimSuffix(url, "/")
+	for id, scheme := range irmaConfig.SchemeManagers {
+		if strings.TrimSuffix(scheme.URL, "/") == url {
+			return scheme, id.String()
+		}
+	}
+	for id, scheme := range irmaConfig.RequestorSchemes {
+		if strings.TrimSuffix(scheme.URL, "/") == url {
+			return scheme, id.String()
+		}
+	}
+	return nil, ""
+}
+
+// The IRMA app keeps functioning when the scheme is down, so all issues that we
+// find are warnings, except for the expiry of public keys: issuance stops
+// without them.
+func checkSchemeManager(ctx context.Context, irmaConfig *irma.Configuration, url string, keyExpiry ExpiryHorizons) (ret issueEntries) {
+	log.Printf(" checking schememanager %s", url)
+
+	schemeMu.Lock()
+	defer schemeMu.Unlock()
+	// An update can't be interrupted (every request of it times out on its
+	// own), so don't start one when the cycle is over already.
+	if ctx.Err() != nil {
+		return
+	}
+
+	scheme, id := findScheme(irmaConfig, url)
+	if scheme == nil {
+		ret = append(ret, issueEntry{issueType: warning, condition: "not-installed", message: fmt.Sprintf("%s: irma scheme verify: scheme is not installed", url)})
+		return
+	}
 
 	// Clear warnings of previous invocations
 	irmaConfig.Warnings = []string{}
 
 	// Schemes are already downloaded in main(), only an update is required now
-	// Updating the schemes also automatically reparses them when necessary, populating irmaConfig.Warnings
-	err := irmaConfig.UpdateSchemes()
+	// Updating the scheme also automatically reparses it when necessary, populating irmaConfig.Warnings
+	err := irmaConfig.UpdateScheme(scheme, nil)
 	if err != nil {
-		ret = append(ret, issueEntry{warning, fmt.Sprintf("irma scheme verify: update schemes: %s", err)})
+		ret = append(ret, issueEntry{issueType: warning, condition: "update", message: fmt.Sprintf("%s: irma scheme verify: update scheme: %s", url, err)})
 		return
 	}
 
-	// ParseFolder of UpdateSchemes is skipped when non of the schemes had to be updated. To enforce
+	// ParseFolder of UpdateScheme is skipped when the scheme did not have to be updated. To enforce
 	// the warnings from ParseFolder to be generated always, ParseFolder has to be invoked here too.
 	// To avoid duplicate warnings, also clear warnings again.
 	irmaConfig.Warnings = []string{}
 	err = irmaConfig.ParseFolder()
 	if err != nil {
-		ret = append(ret, issueEntry{warning, fmt.Sprintf("irma scheme verify: parse folder: %s", err)})
+		ret = append(ret, issueEntry{issueType: warning, condition: "parse", message: fmt.Sprintf("irma scheme verify: parse folder: %s", err)})
 		return
 	}
 
-	// Check expiry dates on public keys
+	if manager, ok := scheme.(*irma.SchemeManager); ok {
+		recordSchemeSnapshot(url, newSchemeSnapshot(irmaConfig, manager), id)
+	}
+
+	// Check the public keys. One invalid key must not hide the expiry of the
+	// others, so the expiry dates are checked regardless.
 	if err = irmaConfig.ValidateKeys(); err != nil {
-		ret = append(ret, issueEntry{warning, fmt.Sprintf("irma scheme verify: keys: %s", err)})
-		return
+		ret = append(ret, issueEntry{issueType: warning, condition: "keys", message: fmt.Sprintf("irma scheme verify: keys: %s", err)})
+	}
+
+	if manager, ok := scheme.(*irma.SchemeManager); ok {
+		ret = append(ret, checkIssuerKeys(irmaConfig, manager, keyExpiry, time.Now())...)
 	}
 
+	// The warnings cover all installed schemes; only report the ones about
+	// this scheme, which name its identifiers or its directory.
 	for _, warn := range irmaConfig.Warnings {
-		ret = append(ret, issueEntry{warning, warn})
+		if isKeyExpiryWarning(warn) {
+			continue
+		}
+		if mentionsScheme(warn, id) {
+			ret = append(ret, issueEntry{issueType: warning, condition: "warning:" + warn, message: warn})
+		}
 	}
 
 	return
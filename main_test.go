@@ -1,6 +1,8 @@
 package main
 
 import (
+	"context"
+	"fmt"
 	"net"
 	"net/http"
 	"net/http/httptest"
@@ -66,13 +68,16 @@ func resetDebounceState(threshold int) {
 	failureStreaks = map[string]int{}
 	recoveryStreaks = map[string]int{}
 	confirmedSet = map[string]issueEntry{}
+	pendingSet = map[string]issueEntry{}
+	lastRun = map[checkTarget]time.Time{}
+	lastIssues = map[checkTarget]issueEntries{}
+	lastReminded = map[string]time.Time{}
+	runCounts = map[checkTarget]int{}
 	conf.FailureThreshold = threshold
-	cycleCount = 0
-	initialCheck = false
 }
 
 func issue(msg string) issueEntry {
-	return issueEntry{danger, msg}
+	return issueEntry{issueType: danger, message: msg}
 }
 
 // confirmedMessages runs one debounce cycle and returns the confirmed messages.
@@ -180,6 +185,59 @@ func TestDebounceEndToEnd(t *testing.T) {
 	}
 }
 
+// TestChangingMessageKeepsIssueOpen: the days left on an expiring certificate
+// change daily; that must not report the issue as fixed and new again.
+func TestChangingMessageKeepsIssueOpen(t *testing.T) {
+	resetDebounceState(1)
+
+	expiring := func(days int) issueEntry {
+		return issueEntry{
+			issueType: warning,
+			message:   fmt.Sprintf("https://yivi.app: certificate from Let's Encrypt will expire in %d days", days),
+			kind:      kindCertificate,
+			target:    "https://yivi.app",
+			condition: "expiring:3f",
+		}
+	}
+
+	reported := confirmIssues(issueEntries{expiring(12)})
+	confirmed := confirmIssues(issueEntries{expiring(11)})
+	newIssues, fixedIssues := difference(reported, confirmed)
+	if len(newIssues) != 0 || len(fixedIssues) != 0 {
+		t.Fatalf("expected no churn, got new=%v fixed=%v", newIssues.messages(), fixedIssues.messages())
+	}
+	if len(confirmed) != 1 || confirmed[0].message != expiring(11).message {
+		t.Errorf("expected the confirmed issue to carry the latest message, got %v", confirmed.messages())
+	}
+}
+
+// TestDifferenceAnnouncesEscalation: an issue that gets more severe is
+// announced again, without being announced fixed; one that gets less severe
+// is not announced, but remembers that it was a danger, so that its recovery
+// is paged when it is fixed.
+func TestDifferenceAnnouncesEscalation(t *testing.T) {
+	resetDebounceState(1)
+	slow := func(typ issueType) issueEntry {
+		return issueEntry{issueType: typ, message: "https://yivi.app: slow", kind: kindHealthCheck, target: "https://yivi.app", condition: "slow"}
+	}
+
+	warned := confirmIssues(issueEntries{slow(warning)})
+	paged := confirmIssues(issueEntries{slow(danger)})
+	newIssues, fixedIssues := difference(warned, paged)
+	if len(newIssues) != 1 || newIssues[0].issueType != danger || len(fixedIssues) != 0 {
+		t.Errorf("expected only the escalation to be announced, got new=%v fixed=%v", newIssues, fixedIssues)
+	}
+	calmed := confirmIssues(issueEntries{slow(warning)})
+	newIssues, fixedIssues = difference(paged, calmed)
+	if len(newIssues) != 0 || len(fixedIssues) != 0 {
+		t.Errorf("expected no churn on de-escalation, got new=%v fixed=%v", newIssues, fixedIssues)
+	}
+	_, fixedIssues = difference(calmed, confirmIssues(nil))
+	if len(fixedIssues) != 1 || fixedIssues[0].issueType != warning || !fixedIssues[0].wasDanger {
+		t.Errorf("expected the fixed issue to remember it was a danger, got %+v", fixedIssues)
+	}
+}
+
 // TestConfirmIssuesDebouncesSingleCycleRecoveryBlip: a confirmed issue that
 // flaps to OK for a single cycle stays confirmed.
 func TestConfirmIssuesDebouncesSingleCycleRecoveryBlip(t *testing.T) {
@@ -244,14 +302,17 @@ func TestConfirmIssuesReportsFixedAfterThreshold(t *testing.T) {
 	}
 }
 
-// stepInitialWindow mirrors the initialCheck bookkeeping in runChecks.
+// stepInitialWindow mirrors the bookkeeping of the initial state in runChecks
+// for a single check with the global schedule, and reports whether it is still
+// in its initial state.
 func stepInitialWindow() bool {
-	cycleCount++
-	initialCheck = cycleCount <= conf.FailureThreshold
-	return initialCheck
+	lastRun = map[checkTarget]time.Time{} // always due
+	jobs := []checkJob{{checkTarget: checkTarget{kindHealthCheck, "https://yivi.app"}, schedule: Schedule{}.orDefault()}}
+	dueJobs(jobs, time.Now(), time.Minute)
+	return initialTargets(jobs)[jobs[0].checkTarget]
 }
 
-// TestInitialCheckWindowCoversDebounceDelay: the initialCheck window must stay
+// TestInitialCheckWindowCoversDebounceDelay: the initial state must last
 // open until a startup-present issue is confirmed (on cycle FailureThreshold),
 // else a restart-time outage would page as brand new.
 func TestInitialCheckWindowCoversDebounceDelay(t *testing.T) {
@@ -298,3 +359,44 @@ func TestInitialCheckThresholdOneMatchesOldBehaviour(t *testing.T) {
 		t.Fatalf("cycle 2: expected initialCheck to be false")
 	}
 }
+
+// TestCheckAtumServerGivesUpOnHangingServer: the check stops waiting for a
+// server that doesn't answer, and doesn't send another request while the
+// earlier one still hangs.
+func TestCheckAtumServerGivesUpOnHangingServer(t *testing.T) {
+	var requests atomic.Int32
+	release := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		<-release
+	}))
+	defer srv.Close()
+	defer close(release)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	issues := checkAtumServer(ctx, srv.URL)
+	if len(issues) != 1 || issues[0].condition != "deadline" {
+		t.Fatalf("expected a deadline issue, got %+v", issues)
+	}
+	issues = checkAtumServer(context.Background(), srv.URL)
+	if len(issues) != 1 || issues[0].condition != "deadline" || requests.Load() != 1 {
+		t.Errorf("expected the earlier request to be waited for, got %+v after %d requests", issues, requests.Load())
+	}
+}
+
+func TestMentionsScheme(t *testing.T) {
+	for warn, want := range map[string]bool{
+		"pbdf.gemeente.personalData: deprecated":          true,
+		"Issuer pbdf.pbdf has no public keys":             true,
+		"/tmp/irma_configuration/pbdf/timestamp: missing": true,
+		"xpbdf.gemeente: deprecated":                      false,
+		"my-pbdf.issuer: deprecated":                      false,
+		"irma-demo.RU: deprecated":                        false,
+		"xpbdf.gemeente replaces pbdf.gemeente":           true,
+	} {
+		if got := mentionsScheme(warn, "pbdf"); got != want {
+			t.Errorf("mentionsScheme(%q, pbdf) = %v, want %v", warn, got, want)
+		}
+	}
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"crypto/x509"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// Prometheus metrics, served on /metrics. Check results are exported as raw
+// per-cycle observations rather than the debounced confirmed set: Prometheus
+// alerting rules do their own debouncing (`for:`), and the raw signal is what
+// is needed to see flapping.
+var (
+	checkUpGauge = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "irma_watchdog_check_up",
+		Help: "Whether the last run of a check found no issues (1) or at least one (0).",
+	}, []string{"check", "target"})
+
+	checkSeverityGauge = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "irma_watchdog_check_severity",
+		Help: "Highest severity found by the last run of a check: 0 ok (or only info), 1 warning, 2 danger.",
+	}, []string{"check", "target"})
+
+	certificateExpiryGauge = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "irma_watchdog_certificate_expiry_days",
+		Help: "Days until expiry of each certificate presented by a checked host (negative once expired).",
+	}, []string{"target", "subject", "issuer"})
+
+	requestPhaseHistogram = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "irma_watchdog_request_phase_duration_seconds",
+		Help:    "Duration of the connection phases of the final attempt of each HTTP check.",
+		Buckets: []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10},
+	}, []string{"check", "target", "phase"})
+
+	cycleDurationGauge = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "irma_watchdog_cycle_duration_seconds",
+		Help: "Duration of the last complete check cycle.",
+	})
+
+	lastCycleGauge = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "irma_watchdog_last_cycle_timestamp_seconds",
+		Help: "Unix time at which the last check cycle completed.",
+	})
+
+	notificationsCounter = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "irma_watchdog_notifications_total",
+		Help: "Notification deliveries, by notifier and result.",
+	}, []string{"notifier", "result"})
+)
+
+// recordCheckMetrics publishes the up/severity gauges for one cycle's issues.
+func recordCheckMetrics(checks []checkTarget, curIssues issueEntries) {
+	severity := make(map[checkTarget]int, len(checks))
+	for _, issue := range curIssues {
+		key := checkTarget{issue.kind, issue.target}
+		if s := int(issue.issueType) + 1; s > severity[key] {
+			severity[key] = s
+		}
+	}
+
+	// Reset so that checks removed from the configuration don't linger.
+	checkUpGauge.Reset()
+	checkSeverityGauge.Reset()
+	for _, check := range checks {
+		up := 1.0
+		if severity[check] > 0 {
+			up = 0
+		}
+		checkUpGauge.WithLabelValues(string(check.kind), check.target).Set(up)
+		checkSeverityGauge.WithLabelValues(string(check.kind), check.target).Set(float64(severity[check]))
+	}
+}
+
+func recordCycleMetrics(start time.Time) {
+	cycleDurationGauge.Set(time.Since(start).Seconds())
+	lastCycleGauge.SetToCurrentTime()
+}
+
+func recordCertificateExpiry(target string, cert *x509.Certificate) {
+	days := time.Until(cert.NotAfter).Hours() / 24
+	certificateExpiryGauge.WithLabelValues(target, cert.Subject.CommonName, strings.Join(cert.Issuer.Organization, ", ")).Set(days)
+}
+
+func recordRequestPhases(kind checkKind, target string, trace *requestTrace) {
+	for phase, d := range trace.phases() {
+		requestPhaseHistogram.WithLabelValues(string(kind), target, phase).Observe(d.Seconds())
+	}
+}
+
+func recordNotification(notifier string, ok bool) {
+	result := "success"
+	if !ok {
+		result = "failure"
+	}
+	notificationsCounter.WithLabelValues(notifier, result).Inc()
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// scrapeMetrics returns the text exposition of the default registry, as
+// Prometheus would see it on /metrics.
+func scrapeMetrics(t *testing.T) string {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	promhttp.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	body, err := io.ReadAll(rec.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(body)
+}
+
+func TestRecordCheckMetricsUpAndSeverity(t *testing.T) {
+	checks := []checkTarget{
+		{kindHealthCheck, "https://yivi.app"},
+		{kindHealthCheck, "https://keyshare.yivi.app"},
+		{kindCertificate, "https://privacybydesign.foundation"},
+	}
+	recordCheckMetrics(checks, issueEntries{
+		{issueType: warning, kind: kindCertificate, target: "https://privacybydesign.foundation", message: "expires soon"},
+		{issueType: danger, kind: kindHealthCheck, target: "https://keyshare.yivi.app", message: "cannot be reached"},
+		{issueType: warning, kind: kindHealthCheck, target: "https://keyshare.yivi.app", message: "slow"},
+	})
+
+	body := scrapeMetrics(t)
+	for _, want := range []string{
+		`irma_watchdog_check_up{check="healthcheck",target="https://yivi.app"} 1`,
+		`irma_watchdog_check_severity{check="healthcheck",target="https://yivi.app"} 0`,
+		`irma_watchdog_check_up{check="healthcheck",target="https://keyshare.yivi.app"} 0`,
+		// The highest severity wins.
+		`irma_watchdog_check_severity{check="healthcheck",target="https://keyshare.yivi.app"} 2`,
+		`irma_watchdog_check_severity{check="certificate",target="https://privacybydesign.foundation"} 1`,
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("metrics output lacks %q", want)
+		}
+	}
+
+	// A check that is no longer configured must disappear from the output.
+	recordCheckMetrics(checks[:1], nil)
+	if body := scrapeMetrics(t); strings.Contains(body, "keyshare.yivi.app") {
+		t.Errorf("removed check still exported:\n%s", body)
+	}
+}
+
+func TestRecordNotificationCounts(t *testing.T) {
+	recordNotification("webhook", true)
+	recordNotification("webhook", false)
+
+	body := scrapeMetrics(t)
+	for _, want := range []string{
+		`irma_watchdog_notifications_total{notifier="webhook",result="success"}`,
+		`irma_watchdog_notifications_total{notifier="webhook",result="failure"}`,
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("metrics output lacks %q", want)
+		}
+	}
+}
@@ -33,7 +33,7 @@ func TestHandlerStateRace(t *testing.T) {
 				return
 			default:
 			}
-			setState(issueEntries{{warning, "x"}}, time.Now())
+			setState(issueEntries{{issueType: warning, message: "x"}}, time.Now())
 		}
 	}()
 
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/ashwanthkumar/slack-go-webhook"
+	"github.com/dustin/go-humanize"
+)
+
+// Reminders configures how often issues that stay open are announced again.
+// Zero disables the reminders for that severity.
+type Reminders struct {
+	Danger  time.Duration
+	Warning time.Duration
+}
+
+func (r Reminders) interval(t issueType) time.Duration {
+	switch t {
+	case danger:
+		return r.Danger
+	case warning:
+		return r.Warning
+	}
+	return 0 // info is announced once
+}
+
+// lastReminded is when each confirmed issue, by id, was last announced: first
+// as new and then by reminders. Only touched by the check goroutine.
+var lastReminded = map[string]time.Time{}
+
+// dueReminders returns the confirmed issues that are due for a reminder at
+// now, and marks them as reminded.
+func dueReminders(confirmed issueEntries, now time.Time) (due issueEntries) {
+	open := make(map[string]bool, len(confirmed))
+	for _, issue := range confirmed {
+		id := issue.id()
+		open[id] = true
+		prev, ok := lastReminded[id]
+		if !ok {
+			// Just confirmed, so it is being announced as new right now.
+			lastReminded[id] = now
+			continue
+		}
+		if interval := conf.Reminders.interval(issue.issueType); interval > 0 && now.Sub(prev) >= interval {
+			lastReminded[id] = now
+			due = append(due, issue)
+		}
+	}
+	for id := range lastReminded {
+		if !open[id] {
+			delete(lastReminded, id)
+		}
+	}
+	return
+}
+
+// pushRemindersToSlack sends a single digest of the issues that are still
+// open, rather than a message per issue. Only the reminders that are due are
+// listed; open is the number of open issues in total.
+func pushRemindersToSlack(c Conf, reminders issueEntries, open int, now time.Time) {
+	strWarning := "warning"
+	strBad := "bad"
+
+	digest := func(t issueType) string {
+		var lines []string
+		for _, issue := range reminders {
+			if issue.issueType == t {
+				lines = append(lines, fmt.Sprintf("%s (open for %s)", issue.message, humanize.RelTime(issue.firstSeen, now, "", "")))
+			}
+		}
+		return strings.Join(lines, "\n")
+	}
+
+	var attachments []slack.Attachment
+	if text := digest(danger); text != "" {
+		attachments = append(attachments, slack.Attachment{Fallback: &text, Text: &text, Color: &strBad})
+	}
+	if text := digest(warning); text != "" {
+		attachments = append(attachments, slack.Attachment{Fallback: &text, Text: &text, Color: &strWarning})
+	}
+	pushMessageToSlack(c, reminderHeading(len(reminders), open), attachments)
+}
+
+// reminderHeading introduces a digest of due reminders, without suggesting
+// that those are all the open issues.
+func reminderHeading(due, open int) string {
+	if due == open {
+		return fmt.Sprintf("Reminder: %d issues are still open.", due)
+	}
+	return fmt.Sprintf("Reminder: %d issues are still open (of %d open issues).", due, open)
+}
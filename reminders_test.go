@@ -0,0 +1,64 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestDueRemindersPerSeverity(t *testing.T) {
+	resetDebounceState(1)
+	oldConf := conf
+	defer func() { conf = oldConf }()
+	conf.Reminders = Reminders{Danger: 6 * time.Hour, Warning: 24 * time.Hour}
+
+	down := issueEntry{issueType: danger, message: "down", condition: "unreachable"}
+	expiring := issueEntry{issueType: warning, message: "expiring", condition: "expiring:3f"}
+	open := issueEntries{down, expiring}
+	start := time.Now()
+
+	if due := dueReminders(open, start); len(due) != 0 {
+		t.Fatalf("expected no reminders when the issues are first confirmed, got %v", due.messages())
+	}
+	var reminded []string
+	for h := 1; h <= 24; h++ {
+		reminded = append(reminded, dueReminders(open, start.Add(time.Duration(h)*time.Hour)).messages()...)
+	}
+	dangers, warnings := 0, 0
+	for _, msg := range reminded {
+		switch msg {
+		case "down":
+			dangers++
+		case "expiring":
+			warnings++
+		}
+	}
+	if dangers != 4 || warnings != 1 {
+		t.Errorf("expected 4 danger and 1 warning reminders in a day, got %d and %d", dangers, warnings)
+	}
+}
+
+// TestDueRemindersForgetsFixedIssues: an issue that returns after being fixed
+// is new again, not overdue for a reminder.
+func TestDueRemindersForgetsFixedIssues(t *testing.T) {
+	resetDebounceState(1)
+	oldConf := conf
+	defer func() { conf = oldConf }()
+	conf.Reminders = Reminders{Danger: time.Hour}
+
+	down := issueEntries{{issueType: danger, message: "down", condition: "unreachable"}}
+	start := time.Now()
+	dueReminders(down, start)
+	dueReminders(nil, start.Add(time.Minute))
+	if due := dueReminders(down, start.Add(2*time.Hour)); len(due) != 0 {
+		t.Errorf("expected no reminder for a returning issue, got %v", due.messages())
+	}
+}
+
+func TestReminderHeadingCountsAllOpenIssues(t *testing.T) {
+	if got := reminderHeading(2, 2); got != "Reminder: 2 issues are still open." {
+		t.Errorf("got %q", got)
+	}
+	if got := reminderHeading(1, 5); got != "Reminder: 1 issues are still open (of 5 open issues)." {
+		t.Errorf("got %q", got)
+	}
+}
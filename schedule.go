@@ -0,0 +1,128 @@
+package main
+
+import (
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Schedule overrides the global interval and failure threshold for a single
+// check. Zero values fall back to the global Conf.Interval and
+// Conf.FailureThreshold.
+type Schedule struct {
+	Interval         time.Duration
+	FailureThreshold int
+}
+
+// orDefault returns s with the global defaults filled in.
+func (s Schedule) orDefault() Schedule {
+	if s.Interval <= 0 {
+		s.Interval = conf.Interval
+	}
+	if s.FailureThreshold < 1 {
+		s.FailureThreshold = conf.FailureThreshold
+	}
+	return s
+}
+
+// URLCheck is a check of a single URL. In the configuration it is either just
+// the URL, or a mapping with the url and a schedule:
+//
+//	checkcertificateexpiry:
+//	    - https://yivi.app
+//	    - url: https://privacybydesign.foundation
+//	      interval: 1h
+type URLCheck struct {
+	URL      string
+	Expiry   ExpiryHorizons // certificate checks only
+	Schedule `yaml:",inline"`
+}
+
+func (c *URLCheck) UnmarshalYAML(node *yaml.Node) error {
+	if node.Kind == yaml.ScalarNode {
+		return node.Decode(&c.URL)
+	}
+	type plain URLCheck
+	return node.Decode((*plain)(c))
+}
+
+// SchemeCheck configures the check of a single scheme. In the configuration it
+// is either just the public key of the scheme, or a mapping with the publickey
+// and a schedule.
+type SchemeCheck struct {
+	PublicKey string
+	KeyExpiry ExpiryHorizons
+	Schedule  `yaml:",inline"`
+}
+
+func (c *SchemeCheck) UnmarshalYAML(node *yaml.Node) error {
+	if node.Kind == yaml.ScalarNode {
+		return node.Decode(&c.PublicKey)
+	}
+	type plain SchemeCheck
+	return node.Decode((*plain)(c))
+}
+
+// Scheduler state, only touched by the check goroutine: when each check last
+// ran, the issues it found then, and how often it ran since the watchdog
+// started.
+var (
+	lastRun    = map[checkTarget]time.Time{}
+	lastIssues = map[checkTarget]issueEntries{}
+	runCounts  = map[checkTarget]int{}
+)
+
+// tickInterval is the period of the ticker that drives the check cycles: the
+// shortest interval of any check, so that every check can run on its own
+// cadence.
+func tickInterval(jobs []checkJob) time.Duration {
+	tick := conf.Interval
+	for _, job := range jobs {
+		if job.schedule.Interval < tick {
+			tick = job.schedule.Interval
+		}
+	}
+	return tick
+}
+
+// cycleTimeout is the deadline of a cycle: the configured one, or else the
+// tick, so that a check that hangs doesn't make the faster checks miss their
+// turn. It follows the tick when a reload changes the intervals.
+func cycleTimeout(tick time.Duration) time.Duration {
+	if conf.CycleTimeout > 0 {
+		return conf.CycleTimeout
+	}
+	return tick
+}
+
+// dueJobs returns the jobs that should run in the cycle starting at now, and
+// records that they ran. A job is due once its interval has passed since its
+// previous run, give or take half a tick: ticks don't arrive with perfect
+// regularity, and being a little early beats waiting a whole tick.
+func dueJobs(jobs []checkJob, now time.Time, tick time.Duration) (due []checkJob) {
+	for _, job := range jobs {
+		prev, ok := lastRun[job.checkTarget]
+		if ok && now.Sub(prev) < job.schedule.Interval-tick/2 {
+			continue
+		}
+		lastRun[job.checkTarget] = now
+		runCounts[job.checkTarget]++
+		due = append(due, job)
+	}
+	return
+}
+
+// initialTargets returns the checks whose issues can still be restart
+// artefacts (see runChecks): those that have not yet run often enough since the
+// start to confirm an issue that was present at startup. Every check leaves
+// this state after its own interval times failure threshold, so that a slow
+// check doesn't keep the fast ones quiet.
+func initialTargets(jobs []checkJob) map[checkTarget]bool {
+	initial := map[checkTarget]bool{}
+	for _, job := range jobs {
+		if runCounts[job.checkTarget] <= job.schedule.FailureThreshold {
+			initial[job.checkTarget] = true
+		}
+	}
+	return initial
+}
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+func TestURLCheckAcceptsPlainURLAndMapping(t *testing.T) {
+	var c Conf
+	err := yaml.Unmarshal([]byte(`
+checkcertificateexpiry:
+    - https://yivi.app
+    - url: https://privacybydesign.foundation
+      interval: 1h
+      failurethreshold: 1
+`), &c)
+	if err != nil {
+		t.Fatalf("unmarshal: %s", err)
+	}
+	want := []URLCheck{
+		{URL: "https://yivi.app"},
+		{URL: "https://privacybydesign.foundation", Schedule: Schedule{Interval: time.Hour, FailureThreshold: 1}},
+	}
+	if len(c.CheckCertificateExpiry) != len(want) {
+		t.Fatalf("got %+v, want %+v", c.CheckCertificateExpiry, want)
+	}
+	for i := range want {
+		if c.CheckCertificateExpiry[i] != want[i] {
+			t.Errorf("check %d = %+v, want %+v", i, c.CheckCertificateExpiry[i], want[i])
+		}
+	}
+}
+
+func TestHealthCheckScheduleIsInline(t *testing.T) {
+	var c Conf
+	err := yaml.Unmarshal([]byte(`
+healthchecks:
+    - requesturl: https://yivi.app/health
+      interval: 30s
+`), &c)
+	if err != nil {
+		t.Fatalf("unmarshal: %s", err)
+	}
+	if len(c.HealthChecks) != 1 || c.HealthChecks[0].Interval != 30*time.Second {
+		t.Errorf("expected the interval override to be read, got %+v", c.HealthChecks)
+	}
+}
+
+func TestDueJobsHonoursPerCheckInterval(t *testing.T) {
+	resetDebounceState(3)
+	jobs := []checkJob{
+		{checkTarget: checkTarget{kindHealthCheck, "fast"}, schedule: Schedule{Interval: time.Minute, FailureThreshold: 3}},
+		{checkTarget: checkTarget{kindCertificate, "slow"}, schedule: Schedule{Interval: time.Hour, FailureThreshold: 1}},
+	}
+	tick := tickInterval(jobs)
+	if tick != time.Minute {
+		t.Fatalf("tick = %s, want the shortest interval 1m", tick)
+	}
+
+	start := time.Now()
+	ran := map[string]int{}
+	for i := 0; i < 120; i++ {
+		// Ticks drift a little; that must not make a check skip a run.
+		now := start.Add(time.Duration(i)*tick + time.Duration(i%3)*time.Second)
+		for _, job := range dueJobs(jobs, now, tick) {
+			ran[job.target]++
+		}
+	}
+	if ran["fast"] != 120 || ran["slow"] != 2 {
+		t.Errorf("expected 120 fast and 2 slow runs in two hours, got %v", ran)
+	}
+}
+
+// TestConfirmCheckedIssuesLeavesIdleChecksAlone: a check that did not run this
+// cycle has neither recovered nor failed again.
+func TestConfirmCheckedIssuesLeavesIdleChecksAlone(t *testing.T) {
+	resetDebounceState(1)
+	slow := checkTarget{kindCertificate, "https://yivi.app"}
+	fast := checkTarget{kindHealthCheck, "https://yivi.app/health"}
+	certIssue := issueEntry{issueType: warning, message: "cert expires soon", kind: slow.kind, target: slow.target}
+
+	confirmCheckedIssues(issueEntries{certIssue}, map[checkTarget]int{slow: 1, fast: 1})
+	for cycle := 0; cycle < 5; cycle++ {
+		got := confirmCheckedIssues(nil, map[checkTarget]int{fast: 1})
+		if len(got) != 1 || got[0].message != certIssue.message {
+			t.Fatalf("cycle %d: issue of idle check was dropped: %v", cycle, got.messages())
+		}
+	}
+	if got := confirmCheckedIssues(nil, map[checkTarget]int{slow: 1, fast: 1}); len(got) != 0 {
+		t.Errorf("expected the issue to be fixed once its check ran again, got %v", got.messages())
+	}
+}
+
+func TestConfirmCheckedIssuesUsesPerCheckThreshold(t *testing.T) {
+	resetDebounceState(3)
+	target := checkTarget{kindHealthCheck, "https://yivi.app/health"}
+	down := issueEntry{issueType: danger, message: "down", kind: target.kind, target: target.target}
+
+	if got := confirmCheckedIssues(issueEntries{down}, map[checkTarget]int{target: 1}); len(got) != 1 {
+		t.Errorf("expected threshold 1 to confirm immediately, got %v", got.messages())
+	}
+}
+
+// TestInitialTargetsPerCheck: a fast check leaves its initial state after its
+// own interval times threshold, while a slow check is still in it.
+func TestInitialTargetsPerCheck(t *testing.T) {
+	resetDebounceState(3)
+	fast := checkTarget{kindHealthCheck, "fast"}
+	slow := checkTarget{kindCertificate, "slow"}
+	jobs := []checkJob{
+		{checkTarget: fast, schedule: Schedule{Interval: time.Minute, FailureThreshold: 3}},
+		{checkTarget: slow, schedule: Schedule{Interval: time.Hour, FailureThreshold: 2}},
+	}
+	start := time.Now()
+	for minute := range 4 {
+		dueJobs(jobs, start.Add(time.Duration(minute)*time.Minute), time.Minute)
+	}
+	if initial := initialTargets(jobs); initial[fast] || !initial[slow] {
+		t.Errorf("after 4 minutes, expected only the slow check to be initial, got %v", initial)
+	}
+	for minute := 4; minute <= 60; minute++ {
+		dueJobs(jobs, start.Add(time.Duration(minute)*time.Minute), time.Minute)
+	}
+	if initial := initialTargets(jobs); !initial[slow] {
+		t.Errorf("after one hour, expected the slow check to be initial still, got %v", initial)
+	}
+	dueJobs(jobs, start.Add(2*time.Hour), time.Minute)
+	if initial := initialTargets(jobs); len(initial) != 0 {
+		t.Errorf("after two hours, expected no initial checks, got %v", initial)
+	}
+}
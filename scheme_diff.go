@@ -0,0 +1,188 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"maps"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ashwanthkumar/slack-go-webhook"
+	irma "github.com/privacybydesign/irmago"
+)
+
+// schemeSnapshot is the part of the contents of a scheme whose changes are
+// announced: what can be issued, and with which keys.
+type schemeSnapshot struct {
+	Timestamp       time.Time
+	Issuers         []string
+	CredentialTypes []string
+	AttributeTypes  []string
+	PublicKeys      map[string][]uint // issuer: counters of its public keys
+}
+
+// schemeChange lists what changed in a scheme between two of its updates.
+type schemeChange struct {
+	URL     string
+	Scheme  string // identifier
+	Changes []string
+}
+
+func (c schemeChange) String() string {
+	return fmt.Sprintf("%s: scheme %s changed:\n%s", c.URL, c.Scheme, strings.Join(c.Changes, "\n"))
+}
+
+// The last snapshot of every scheme by URL, and the changes found since
+// runChecks last took them. They have a mutex of their own, rather than
+// schemeMu, so that the check goroutine doesn't have to wait for a scheme update
+// that runs late.
+var (
+	schemeSnapshotsMu sync.Mutex
+	schemeSnapshots   = map[string]schemeSnapshot{}
+	schemeChanges     []schemeChange
+)
+
+// newSchemeSnapshot takes a snapshot of scheme, as parsed into irmaConfig.
+func newSchemeSnapshot(irmaConfig *irma.Configuration, scheme *irma.SchemeManager) schemeSnapshot {
+	id := scheme.Identifier()
+	snapshot := schemeSnapshot{
+		Timestamp:  time.Time(scheme.Timestamp),
+		PublicKeys: map[string][]uint{},
+	}
+	for issuer := range irmaConfig.Issuers {
+		if issuer.SchemeManagerIdentifier() != id {
+			continue
+		}
+		snapshot.Issuers = append(snapshot.Issuers, issuer.String())
+		if counters, err := irmaConfig.PublicKeyIndices(issuer); err == nil {
+			slices.Sort(counters)
+			snapshot.PublicKeys[issuer.String()] = counters
+		}
+	}
+	for cred := range irmaConfig.CredentialTypes {
+		if cred.IssuerIdentifier().SchemeManagerIdentifier() == id {
+			snapshot.CredentialTypes = append(snapshot.CredentialTypes, cred.String())
+		}
+	}
+	for attr := range irmaConfig.AttributeTypes {
+		if attr.CredentialTypeIdentifier().IssuerIdentifier().SchemeManagerIdentifier() == id {
+			snapshot.AttributeTypes = append(snapshot.AttributeTypes, attr.String())
+		}
+	}
+	slices.Sort(snapshot.Issuers)
+	slices.Sort(snapshot.CredentialTypes)
+	slices.Sort(snapshot.AttributeTypes)
+	return snapshot
+}
+
+// diffSchemeSnapshots describes the changes from old to cur, one per line.
+func diffSchemeSnapshots(old, cur schemeSnapshot) (changes []string) {
+	added, removed := diffSorted(old.Issuers, cur.Issuers)
+	changes = append(changes, describe("issuer", added, removed)...)
+	added, removed = diffSorted(old.CredentialTypes, cur.CredentialTypes)
+	changes = append(changes, describe("credential type", added, removed)...)
+	added, removed = diffSorted(old.AttributeTypes, cur.AttributeTypes)
+	changes = append(changes, describe("attribute type", added, removed)...)
+
+	for _, issuer := range slices.Sorted(maps.Keys(cur.PublicKeys)) {
+		if _, ok := old.PublicKeys[issuer]; !ok {
+			continue // new issuer, reported above
+		}
+		added, removed := diffSorted(old.PublicKeys[issuer], cur.PublicKeys[issuer])
+		for _, counter := range added {
+			changes = append(changes, fmt.Sprintf("public key %d of %s added", counter, issuer))
+		}
+		for _, counter := range removed {
+			changes = append(changes, fmt.Sprintf("public key %d of %s removed", counter, issuer))
+		}
+	}
+
+	if !cur.Timestamp.Equal(old.Timestamp) {
+		changes = append(changes, fmt.Sprintf("timestamp changed from %s to %s",
+			old.Timestamp.UTC().Format(time.RFC3339), cur.Timestamp.UTC().Format(time.RFC3339)))
+	}
+	return
+}
+
+// diffSorted returns the elements of cur that are not in old, and the
+// elements of old that are not in cur. Both must be sorted.
+func diffSorted[T interface{ ~string | ~uint }](old, cur []T) (added, removed []T) {
+	for _, x := range cur {
+		if _, found := slices.BinarySearch(old, x); !found {
+			added = append(added, x)
+		}
+	}
+	for _, x := range old {
+		if _, found := slices.BinarySearch(cur, x); !found {
+			removed = append(removed, x)
+		}
+	}
+	return
+}
+
+func describe(what string, added, removed []string) (changes []string) {
+	for _, id := range added {
+		changes = append(changes, fmt.Sprintf("%s %s added", what, id))
+	}
+	for _, id := range removed {
+		changes = append(changes, fmt.Sprintf("%s %s removed", what, id))
+	}
+	return
+}
+
+// recordSchemeSnapshot compares the scheme at url with its previous snapshot,
+// if any, and queues the changes for announcement.
+func recordSchemeSnapshot(url string, snapshot schemeSnapshot, scheme string) {
+	schemeSnapshotsMu.Lock()
+	defer schemeSnapshotsMu.Unlock()
+	prev, ok := schemeSnapshots[url]
+	schemeSnapshots[url] = snapshot
+	if !ok {
+		return
+	}
+	if changes := diffSchemeSnapshots(prev, snapshot); len(changes) > 0 {
+		log.Printf("Scheme %s changed: %s", scheme, strings.Join(changes, "; "))
+		schemeChanges = append(schemeChanges, schemeChange{URL: url, Scheme: scheme, Changes: changes})
+	}
+}
+
+// takeSchemeChanges returns the changes found since the previous call.
+func takeSchemeChanges() []schemeChange {
+	schemeSnapshotsMu.Lock()
+	defer schemeSnapshotsMu.Unlock()
+	changes := schemeChanges
+	schemeChanges = nil
+	return changes
+}
+
+func pushSchemeChangesToSlack(c Conf, changes []schemeChange) {
+	for _, change := range changes {
+		text := strings.Join(change.Changes, "\n")
+		color := "#439FE0"
+		pushMessageToSlack(c, fmt.Sprintf("Scheme %s (%s) changed.", change.Scheme, change.URL), []slack.Attachment{{
+			Fallback: &text,
+			Text:     &text,
+			Color:    &color,
+		}})
+	}
+}
+
+func newSchemeChangeEvents(changes []schemeChange, now time.Time) []webHookEvent {
+	events := make([]webHookEvent, len(changes))
+	for i, change := range changes {
+		events[i] = webHookEvent{
+			Event: eventChange,
+			apiIssue: apiIssue{
+				ID:       fmt.Sprintf("%s|%s|change:%d", kindSchemeManager, change.URL, now.Unix()),
+				Severity: info.String(),
+				Message:  change.String(),
+				Check:    kindSchemeManager,
+				Target:   change.URL,
+			},
+			Timestamp: now,
+		}
+	}
+	return events
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestDiffSchemeSnapshots(t *testing.T) {
+	old := schemeSnapshot{
+		Timestamp:       time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC),
+		Issuers:         []string{"pbdf.gemeente", "pbdf.pbdf"},
+		CredentialTypes: []string{"pbdf.gemeente.address", "pbdf.pbdf.email"},
+		AttributeTypes:  []string{"pbdf.gemeente.address.city", "pbdf.pbdf.email.email"},
+		PublicKeys:      map[string][]uint{"pbdf.gemeente": {1, 2}, "pbdf.pbdf": {3}},
+	}
+	if changes := diffSchemeSnapshots(old, old); len(changes) != 0 {
+		t.Errorf("expected no changes, got %q", changes)
+	}
+
+	cur := schemeSnapshot{
+		Timestamp:       time.Date(2024, 2, 1, 0, 0, 0, 0, time.UTC),
+		Issuers:         []string{"pbdf.gemeente", "pbdf.sidn-pbdf"},
+		CredentialTypes: []string{"pbdf.gemeente.address", "pbdf.sidn-pbdf.email"},
+		AttributeTypes:  []string{"pbdf.gemeente.address.city", "pbdf.gemeente.address.street", "pbdf.sidn-pbdf.email.email"},
+		PublicKeys:      map[string][]uint{"pbdf.gemeente": {2, 3}, "pbdf.sidn-pbdf": {1}},
+	}
+	want := []string{
+		"issuer pbdf.sidn-pbdf added",
+		"issuer pbdf.pbdf removed",
+		"credential type pbdf.sidn-pbdf.email added",
+		"credential type pbdf.pbdf.email removed",
+		"attribute type pbdf.gemeente.address.street added",
+		"attribute type pbdf.sidn-pbdf.email.email added",
+		"attribute type pbdf.pbdf.email.email removed",
+		"public key 3 of pbdf.gemeente added",
+		"public key 1 of pbdf.gemeente removed",
+		"timestamp changed from 2024-01-01T00:00:00Z to 2024-02-01T00:00:00Z",
+	}
+	if changes := diffSchemeSnapshots(old, cur); !slices.Equal(changes, want) {
+		t.Errorf("changes = %q\nwant %q", changes, want)
+	}
+}
+
+func TestRecordSchemeSnapshotQueuesChanges(t *testing.T) {
+	oldSnapshots, oldChanges := schemeSnapshots, schemeChanges
+	defer func() { schemeSnapshots, schemeChanges = oldSnapshots, oldChanges }()
+	schemeSnapshots, schemeChanges = map[string]schemeSnapshot{}, nil
+
+	url := "https://schemes.yivi.app/pbdf"
+	snapshot := schemeSnapshot{Issuers: []string{"pbdf.pbdf"}}
+	recordSchemeSnapshot(url, snapshot, "pbdf")
+	if changes := takeSchemeChanges(); len(changes) != 0 {
+		t.Errorf("the first snapshot is a baseline, got changes %v", changes)
+	}
+
+	recordSchemeSnapshot(url, snapshot, "pbdf")
+	snapshot.Issuers = append(snapshot.Issuers, "pbdf.sidn-pbdf")
+	recordSchemeSnapshot(url, snapshot, "pbdf")
+	changes := takeSchemeChanges()
+	if len(changes) != 1 || changes[0].URL != url || !slices.Equal(changes[0].Changes, []string{"issuer pbdf.sidn-pbdf added"}) {
+		t.Errorf("expected the added issuer, got %+v", changes)
+	}
+	if changes := takeSchemeChanges(); len(changes) != 0 {
+		t.Errorf("expected the changes to be taken only once, got %v", changes)
+	}
+
+	events := newSchemeChangeEvents(changes, time.Now())
+	if len(events) != 1 || events[0].Event != eventChange || events[0].Severity != info.String() {
+		t.Errorf("unexpected events %+v", events)
+	}
+}
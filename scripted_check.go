@@ -0,0 +1,186 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"net/http"
+	"regexp"
+	"slices"
+	"strings"
+	"text/template"
+
+	"github.com/hashicorp/go-retryablehttp"
+)
+
+// ScriptedCheck is a check of a flow of several requests, such as starting a
+// session and then polling its status. Each step is a HealthCheck whose
+// RequestURL, RequestHeaders and RequestBody are text/templates over the
+// values captured by the earlier steps:
+//
+//	steps:
+//	    - requesturl: https://irma.example.com/session
+//	      capture:
+//	          token: {json: $.token}
+//	    - requesturl: https://irma.example.com/session/{{ .token }}/status
+type ScriptedCheck struct {
+	Name  string // identifies the check in issues and metrics
+	Steps []ScriptStep
+
+	Schedule `yaml:",inline"`
+}
+
+type ScriptStep struct {
+	HealthCheck `yaml:",inline"`
+	Capture     map[string]Capture // variable name: where to find its value
+}
+
+// Capture takes a value from a response: the value at a JSONPath or JSON
+// pointer in the body, a header, or the first group of a regular expression
+// on the body (the whole match if it has no groups).
+type Capture struct {
+	JSON   string
+	Header string
+	Regex  string
+}
+
+func runScriptedCheck(ctx context.Context, client *retryablehttp.Client, check ScriptedCheck) (ret issueEntries) {
+	vars := map[string]string{}
+	for i, step := range check.Steps {
+		n := i + 1
+		stepIssue := func(issue issueEntry) issueEntry {
+			issue.condition = fmt.Sprintf("step%d:%s", n, issue.condition)
+			issue.message = fmt.Sprintf("%s: step %d: %s", check.Name, n, issue.message)
+			return issue
+		}
+
+		hc, err := step.render(vars)
+		if err != nil {
+			return append(ret, stepIssue(issueEntry{issueType: warning, condition: "invalid", message: err.Error()}))
+		}
+		issue, resp := doHealthCheck(ctx, client, hc, checkTarget{kindScripted, fmt.Sprintf("%s step %d", check.Name, n)})
+		if issue != nil {
+			ret = append(ret, stepIssue(*issue))
+			if issue.issueType == danger {
+				// The later steps depend on this one.
+				return
+			}
+		}
+		if resp == nil {
+			return
+		}
+		body, err := io.ReadAll(resp.Body)
+		if err != nil {
+			return append(ret, stepIssue(issueEntry{issueType: danger, condition: "unreadable-body", message: err.Error()}))
+		}
+		for name, capture := range step.Capture {
+			value, err := capture.from(resp.Header, body)
+			if err != nil {
+				return append(ret, stepIssue(issueEntry{issueType: danger, condition: "capture:" + name, message: fmt.Sprintf("could not capture %s: %s", name, err)}))
+			}
+			vars[name] = value
+		}
+	}
+	return
+}
+
+// render returns the health check of the step, with the variables filled in.
+func (step ScriptStep) render(vars map[string]string) (HealthCheck, error) {
+	hc := step.HealthCheck
+	var errs []error
+	execute := func(field, text string) string {
+		var b strings.Builder
+		tmpl, err := template.New(field).Option("missingkey=error").Parse(text)
+		if err == nil {
+			err = tmpl.Execute(&b, vars)
+		}
+		if err != nil {
+			errs = append(errs, err)
+		}
+		return b.String()
+	}
+	hc.RequestURL = execute("requesturl", hc.RequestURL)
+	hc.RequestBody = execute("requestbody", hc.RequestBody)
+	hc.RequestHeaders = maps.Clone(hc.RequestHeaders)
+	for key, value := range hc.RequestHeaders {
+		hc.RequestHeaders[key] = execute(key, value)
+	}
+	return hc, errors.Join(errs...)
+}
+
+func (c Capture) from(header http.Header, body []byte) (string, error) {
+	if c.Header != "" {
+		value := header.Get(c.Header)
+		if value == "" {
+			return "", fmt.Errorf("no %s header", c.Header)
+		}
+		return value, nil
+	}
+	if c.Regex != "" {
+		re, err := regexp.Compile(c.Regex)
+		if err != nil {
+			return "", err
+		}
+		m := re.FindSubmatch(body)
+		if m == nil {
+			return "", fmt.Errorf("response body does not match %q", c.Regex)
+		}
+		return string(m[min(1, len(m)-1)]), nil
+	}
+
+	path, err := parseJSONPath(c.JSON)
+	if err != nil {
+		return "", err
+	}
+	var doc any
+	if err := json.Unmarshal(body, &doc); err != nil {
+		return "", fmt.Errorf("response body is not JSON: %w", err)
+	}
+	value, ok := lookup(doc, path)
+	if !ok {
+		return "", fmt.Errorf("%s not found", c.JSON)
+	}
+	if s, ok := value.(string); ok {
+		return s, nil
+	}
+	buf, err := json.Marshal(value)
+	return string(buf), err
+}
+
+func validateScriptedCheck(check ScriptedCheck) error {
+	var errs []error
+	if check.Name == "" {
+		errs = append(errs, errors.New("scriptedchecks: a check without a name"))
+	}
+	if len(check.Steps) == 0 {
+		errs = append(errs, fmt.Errorf("scriptedchecks: %s: no steps", check.Name))
+	}
+	errs = append(errs, validateSchedule("scriptedchecks", check.Name, check.Schedule))
+	for i, step := range check.Steps {
+		for _, text := range slices.Concat([]string{step.RequestURL, step.RequestBody}, slices.Collect(maps.Values(step.RequestHeaders))) {
+			if _, err := template.New("").Parse(text); err != nil {
+				errs = append(errs, fmt.Errorf("scriptedchecks: %s: step %d: %w", check.Name, i+1, err))
+			}
+		}
+		errs = append(errs, validateHealthCheck(step.HealthCheck))
+		for name, capture := range step.Capture {
+			var err error
+			switch {
+			case capture.Header != "":
+			case capture.Regex != "":
+				_, err = regexp.Compile(capture.Regex)
+			case capture.JSON != "":
+				_, err = parseJSONPath(capture.JSON)
+			default:
+				err = errors.New("set one of json, header and regex")
+			}
+			if err != nil {
+				errs = append(errs, fmt.Errorf("scriptedchecks: %s: step %d: capture %s: %w", check.Name, i+1, name, err))
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestRunScriptedCheck(t *testing.T) {
+	var polled bool
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/session":
+			w.Header().Set("Location", "/session/abc")
+			w.Write([]byte(`{"token": "abc", "sessionPtr": {"u": "https://irma.example.com/irma/session/xyz"}}`))
+		case "/broken":
+			w.WriteHeader(http.StatusForbidden)
+		case "/session/abc/status":
+			polled = true
+			if r.Header.Get("Authorization") != "Bearer xyz" || r.Header.Get("X-Location") != "/session/abc" {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			w.Write([]byte(`"INITIALIZED"`))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+
+	newCheck := func() ScriptedCheck {
+		return ScriptedCheck{
+			Name: "session",
+			Steps: []ScriptStep{
+				{
+					HealthCheck: HealthCheck{RequestURL: srv.URL + "/session", RequestMethod: "POST"},
+					Capture: map[string]Capture{
+						"token":    {JSON: "$.token"},
+						"session":  {Regex: `/session/(\w+)"`},
+						"location": {Header: "Location"},
+					},
+				},
+				{
+					HealthCheck: HealthCheck{
+						RequestURL:           srv.URL + "/session/{{ .token }}/status",
+						RequestHeaders:       map[string]string{"Authorization": "Bearer {{ .session }}", "X-Location": "{{ .location }}"},
+						ResponseBodyContains: "INITIALIZED",
+					},
+				},
+			},
+		}
+	}
+
+	if issues := runScriptedCheck(context.Background(), newHTTPClient(), newCheck()); len(issues) != 0 {
+		t.Errorf("expected no issues, got %+v", issues)
+	}
+
+	check := newCheck()
+	check.Steps[0].Capture["missing"] = Capture{JSON: "$.missing"}
+	issues := runScriptedCheck(context.Background(), newHTTPClient(), check)
+	if len(issues) != 1 || issues[0].issueType != danger || issues[0].condition != "step1:capture:missing" {
+		t.Errorf("expected a failed capture in step 1, got %+v", issues)
+	}
+
+	polled = false
+	check = newCheck()
+	check.Steps[0].RequestURL = srv.URL + "/broken"
+	issues = runScriptedCheck(context.Background(), newHTTPClient(), check)
+	if len(issues) != 1 || issues[0].condition != "step1:status-code" {
+		t.Errorf("expected a status code issue in step 1, got %+v", issues)
+	}
+	if polled {
+		t.Errorf("expected the check to stop after the failed step")
+	}
+}
+
+func TestValidateScriptedCheck(t *testing.T) {
+	valid := ScriptedCheck{Name: "session", Steps: []ScriptStep{{
+		HealthCheck: HealthCheck{RequestURL: "https://irma.example.com/session/{{ .token }}"},
+		Capture:     map[string]Capture{"token": {JSON: "$.token"}},
+	}}}
+	if err := validateScriptedCheck(valid); err != nil {
+		t.Errorf("unexpected error: %s", err)
+	}
+
+	for name, check := range map[string]ScriptedCheck{
+		"no name":      {Steps: valid.Steps},
+		"no steps":     {Name: "session"},
+		"bad template": {Name: "session", Steps: []ScriptStep{{HealthCheck: HealthCheck{RequestURL: "https://irma.example.com/{{ .token"}}}},
+		"bad capture":  {Name: "session", Steps: []ScriptStep{{HealthCheck: valid.Steps[0].HealthCheck, Capture: map[string]Capture{"token": {}}}}},
+	} {
+		if err := validateScriptedCheck(check); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+}
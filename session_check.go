@@ -0,0 +1,233 @@
+package main
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"log"
+	"net/url"
+	"strings"
+
+	"github.com/golang-jwt/jwt/v4"
+	irma "github.com/privacybydesign/irmago"
+)
+
+// SessionCheck runs a session on an irma server, the way a requestor would,
+// up to the point where the app would take over: it starts the session,
+// checks the session pointer that would be shown as QR code, polls the status
+// of the session on both the requestor and the app side, and cancels it.
+//
+//	sessionchecks:
+//	    - url: https://is.yivi.app
+//	      authmethod: hmac
+//	      requestor: watchdog
+//	      key: c2VjcmV0Cg==
+//	      disclose: [pbdf.sidn-pbdf.email.email]
+type SessionCheck struct {
+	URL        string // of the irma server, without the /session path
+	AuthMethod string // token, hmac or none; defaults to token if a key is set
+	Requestor  string // name of the requestor, required for hmac
+	Key        string // requestor token, or the base64 encoded HMAC key
+
+	// The session to start: either a disclosure of these attributes, or an
+	// issuance of a credential.
+	Disclose []string
+	Issue    *SessionCheckCredential
+
+	Schedule `yaml:",inline"`
+}
+
+type SessionCheckCredential struct {
+	Credential string
+	Attributes map[string]string
+}
+
+func (check SessionCheck) authMethod() string {
+	if check.AuthMethod != "" {
+		return check.AuthMethod
+	}
+	if check.Key != "" {
+		return "token"
+	}
+	return "none"
+}
+
+// request returns the session request of the check, and the kind of session
+// pointer the server should respond with.
+func (check SessionCheck) request() (irma.RequestorRequest, irma.Action) {
+	var attrs []irma.AttributeTypeIdentifier
+	for _, attr := range check.Disclose {
+		attrs = append(attrs, irma.NewAttributeTypeIdentifier(attr))
+	}
+	if check.Issue != nil {
+		return &irma.IdentityProviderRequest{
+			Request: irma.NewIssuanceRequest([]*irma.CredentialRequest{{
+				CredentialTypeID: irma.NewCredentialTypeIdentifier(check.Issue.Credential),
+				Attributes:       check.Issue.Attributes,
+			}}, attrs...),
+		}, irma.ActionIssuing
+	}
+	return &irma.ServiceProviderRequest{Request: irma.NewDisclosureRequest(attrs...)}, irma.ActionDisclosing
+}
+
+// runSessionCheck starts a session and checks it. Every request of the irma
+// transport times out on its own; ctx only keeps the check from making the
+// next request once the cycle is over.
+func runSessionCheck(ctx context.Context, check SessionCheck) (ret issueEntries) {
+	log.Printf(" checking irma server %s", check.URL)
+	fail := func(severity issueType, condition, format string, args ...any) issueEntries {
+		return append(ret, issueEntry{
+			issueType: severity,
+			condition: condition,
+			message:   fmt.Sprintf("%s: session: %s", check.URL, fmt.Sprintf(format, args...)),
+		})
+	}
+
+	request, action := check.request()
+	pkg, err := startSession(check, request)
+	if err != nil {
+		return fail(danger, "start", "starting a session failed: %s", sessionError(err))
+	}
+	if pkg.Token == "" {
+		return fail(danger, "start", "no requestor token in the response")
+	}
+	requestor := irma.NewHTTPTransport(strings.TrimSuffix(check.URL, "/")+"/session/"+string(pkg.Token), false)
+
+	// From here on there is a session to clean up, whatever else fails.
+	defer func() {
+		if err := requestor.Delete(); err != nil {
+			ret = append(ret, issueEntry{issueType: warning, condition: "cancel", message: fmt.Sprintf("%s: session: cancelling failed: %s", check.URL, sessionError(err))})
+		}
+	}()
+
+	if err := verifySessionPointer(pkg.SessionPtr, action); err != nil {
+		return fail(danger, "session-pointer", "invalid session pointer: %s", err)
+	}
+	if ctx.Err() != nil {
+		return
+	}
+
+	var status irma.ServerStatus
+	if err := requestor.Get("status", &status); err != nil {
+		return fail(danger, "status", "requesting the status failed: %s", sessionError(err))
+	}
+	if status != irma.ServerStatusInitialized {
+		return fail(danger, "status", "session status is %s, expected %s", status, irma.ServerStatusInitialized)
+	}
+
+	if ctx.Err() != nil {
+		return
+	}
+
+	// The app reaches the session through the session pointer, which may well
+	// be a different URL than the one the requestor uses.
+	status = ""
+	if err := irma.NewHTTPTransport(pkg.SessionPtr.URL, false).Get("status", &status); err != nil {
+		return fail(danger, "client-status", "requesting the status at the session pointer failed: %s", sessionError(err))
+	}
+	if status != irma.ServerStatusInitialized {
+		return fail(danger, "client-status", "session status at the session pointer is %s, expected %s", status, irma.ServerStatusInitialized)
+	}
+	return
+}
+
+// sessionPackage is the part of the response to a new session request that
+// the check uses. (The server package of irmago, which defines all of it,
+// would pull in the whole irma server.)
+type sessionPackage struct {
+	SessionPtr *irma.Qr            `json:"sessionPtr"`
+	Token      irma.RequestorToken `json:"token"`
+}
+
+func startSession(check SessionCheck, request irma.RequestorRequest) (*sessionPackage, error) {
+	pkg := &sessionPackage{}
+	transport := irma.NewHTTPTransport(check.URL, false)
+	switch check.authMethod() {
+	case "token":
+		transport.SetHeader("Authorization", check.Key)
+		return pkg, transport.Post("session", pkg, request)
+	case "none":
+		return pkg, transport.Post("session", pkg, request)
+	case "hmac":
+		key, err := base64.StdEncoding.DecodeString(check.Key)
+		if err != nil {
+			return nil, fmt.Errorf("hmac key is not base64 encoded: %w", err)
+		}
+		jwtstr, err := irma.SignRequestorRequest(request, jwt.SigningMethodHS256, key, check.Requestor)
+		if err != nil {
+			return nil, err
+		}
+		return pkg, transport.Post("session", pkg, jwtstr)
+	}
+	return nil, fmt.Errorf("unsupported authmethod %q", check.AuthMethod)
+}
+
+// verifySessionPointer checks the payload of the QR code that the requestor
+// would show: it must point the app to an absolute URL, for the kind of session
+// that was requested.
+func verifySessionPointer(qr *irma.Qr, action irma.Action) error {
+	if qr == nil {
+		return errors.New("missing")
+	}
+	if qr.Type != action {
+		return fmt.Errorf("session type is %q, expected %q", qr.Type, action)
+	}
+	u, err := url.Parse(qr.URL)
+	if err != nil {
+		return err
+	}
+	if (u.Scheme != "https" && u.Scheme != "http") || u.Host == "" {
+		return fmt.Errorf("%q is not an absolute URL", qr.URL)
+	}
+	return nil
+}
+
+// sessionError formats the errors of irmago, which span several lines, for a
+// single line message.
+func sessionError(err error) string {
+	var serr *irma.SessionError
+	if !errors.As(err, &serr) {
+		return err.Error()
+	}
+	if serr.RemoteError != nil {
+		return fmt.Sprintf("%s (status %d): %s", serr.RemoteError.ErrorName, serr.RemoteStatus, serr.RemoteError.Description)
+	}
+	if serr.Err == nil {
+		return fmt.Sprintf("%s (status %d)", serr.ErrorType, serr.RemoteStatus)
+	}
+	if serr.RemoteStatus != 0 && serr.RemoteStatus != 200 {
+		return fmt.Sprintf("%s (status %d): %s", serr.ErrorType, serr.RemoteStatus, serr.Err)
+	}
+	return fmt.Sprintf("%s: %s", serr.ErrorType, serr.Err)
+}
+
+func validateSessionCheck(check SessionCheck) error {
+	var errs []error
+	errs = append(errs, validateURL("sessionchecks", check.URL))
+	errs = append(errs, validateSchedule("sessionchecks", check.URL, check.Schedule))
+	switch check.authMethod() {
+	case "token", "none":
+	case "hmac":
+		if check.Requestor == "" {
+			errs = append(errs, fmt.Errorf("sessionchecks: %s: hmac requires a requestor", check.URL))
+		}
+		if _, err := base64.StdEncoding.DecodeString(check.Key); err != nil {
+			errs = append(errs, fmt.Errorf("sessionchecks: %s: hmac key is not base64 encoded: %w", check.URL, err))
+		}
+	default:
+		errs = append(errs, fmt.Errorf("sessionchecks: %s: unsupported authmethod %q", check.URL, check.AuthMethod))
+	}
+	if len(check.Disclose) == 0 && check.Issue == nil {
+		errs = append(errs, fmt.Errorf("sessionchecks: %s: set disclose or issue", check.URL))
+	}
+	for _, attr := range check.Disclose {
+		if strings.Count(attr, ".") != 3 {
+			errs = append(errs, fmt.Errorf("sessionchecks: %s: %q is not an attribute identifier", check.URL, attr))
+		}
+	}
+	if check.Issue != nil && strings.Count(check.Issue.Credential, ".") != 2 {
+		errs = append(errs, fmt.Errorf("sessionchecks: %s: %q is not a credential type identifier", check.URL, check.Issue.Credential))
+	}
+	return errors.Join(errs...)
+}
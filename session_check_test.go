@@ -0,0 +1,117 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// fakeIrmaServer mimics the requestor and client endpoints of an irma server
+// that are involved in starting, polling and cancelling a session.
+type fakeIrmaServer struct {
+	*httptest.Server
+	action    string // of the session pointer
+	body      string // of the last session request
+	cancelled bool
+}
+
+func newFakeIrmaServer(t *testing.T) *fakeIrmaServer {
+	s := &fakeIrmaServer{action: "disclosing"}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.Method == http.MethodPost && r.URL.Path == "/session":
+			if r.Header.Get("Authorization") != "secret" && !strings.HasPrefix(r.Header.Get("Content-Type"), "text/plain") {
+				w.WriteHeader(http.StatusForbidden)
+				w.Write([]byte(`{"error": "UNAUTHORIZED", "description": "Unauthorized request", "status": 403}`))
+				return
+			}
+			body, _ := io.ReadAll(r.Body)
+			s.body = string(body)
+			json.NewEncoder(w).Encode(map[string]any{
+				"token":      "requestortoken",
+				"sessionPtr": map[string]string{"u": s.URL + "/irma/session/clienttoken", "irmaqr": s.action},
+			})
+		case r.URL.Path == "/session/requestortoken/status", r.URL.Path == "/irma/session/clienttoken/status":
+			status := "INITIALIZED"
+			if s.cancelled {
+				status = "CANCELLED"
+			}
+			json.NewEncoder(w).Encode(status)
+		case r.Method == http.MethodDelete && strings.TrimSuffix(r.URL.Path, "/") == "/session/requestortoken":
+			s.cancelled = true
+			w.WriteHeader(http.StatusNoContent)
+		default:
+			t.Errorf("unexpected request %s %s", r.Method, r.URL)
+			http.NotFound(w, r)
+		}
+	}))
+	return s
+}
+
+func TestRunSessionCheck(t *testing.T) {
+	srv := newFakeIrmaServer(t)
+	defer srv.Close()
+
+	check := SessionCheck{URL: srv.URL, Key: "secret", Disclose: []string{"pbdf.sidn-pbdf.email.email"}}
+	if issues := runSessionCheck(context.Background(), check); len(issues) != 0 {
+		t.Errorf("expected no issues, got %+v", issues)
+	}
+	if !srv.cancelled {
+		t.Errorf("expected the session to be cancelled")
+	}
+	if !strings.Contains(srv.body, "pbdf.sidn-pbdf.email.email") {
+		t.Errorf("expected the requested attribute in the session request, got %s", srv.body)
+	}
+
+	// A broken session pointer is reported, and the session is still cancelled.
+	srv.cancelled = false
+	srv.action = "issuing"
+	issues := runSessionCheck(context.Background(), check)
+	if len(issues) != 1 || issues[0].issueType != danger || issues[0].condition != "session-pointer" {
+		t.Errorf("expected an invalid session pointer, got %+v", issues)
+	}
+	if !srv.cancelled {
+		t.Errorf("expected the session to be cancelled after a failed step")
+	}
+
+	check.Key = "wrong"
+	issues = runSessionCheck(context.Background(), check)
+	if len(issues) != 1 || issues[0].condition != "start" || !strings.Contains(issues[0].message, "UNAUTHORIZED") {
+		t.Errorf("expected a failed start, got %+v", issues)
+	}
+}
+
+func TestRunSessionCheckSignsRequestsWithHMAC(t *testing.T) {
+	srv := newFakeIrmaServer(t)
+	defer srv.Close()
+
+	check := SessionCheck{URL: srv.URL, AuthMethod: "hmac", Requestor: "watchdog", Key: "c2VjcmV0", Disclose: []string{"pbdf.sidn-pbdf.email.email"}}
+	if issues := runSessionCheck(context.Background(), check); len(issues) != 0 {
+		t.Errorf("expected no issues, got %+v", issues)
+	}
+	if strings.Count(srv.body, ".") != 2 {
+		t.Errorf("expected a JWT as session request, got %s", srv.body)
+	}
+}
+
+func TestValidateSessionCheck(t *testing.T) {
+	for name, tc := range map[string]struct {
+		check SessionCheck
+		valid bool
+	}{
+		"disclosure": {SessionCheck{URL: "https://is.yivi.app", Key: "secret", Disclose: []string{"pbdf.sidn-pbdf.email.email"}}, true},
+		"issuance":   {SessionCheck{URL: "https://is.yivi.app", Issue: &SessionCheckCredential{Credential: "irma-demo.MijnOverheid.root"}}, true},
+		"no session": {SessionCheck{URL: "https://is.yivi.app"}, false},
+		"attribute":  {SessionCheck{URL: "https://is.yivi.app", Disclose: []string{"pbdf.sidn-pbdf.email"}}, false},
+		"hmac":       {SessionCheck{URL: "https://is.yivi.app", AuthMethod: "hmac", Key: "c2VjcmV0", Disclose: []string{"pbdf.sidn-pbdf.email.email"}}, false},
+		"authmethod": {SessionCheck{URL: "https://is.yivi.app", AuthMethod: "rsa", Disclose: []string{"pbdf.sidn-pbdf.email.email"}}, false},
+	} {
+		if err := validateSessionCheck(tc.check); (err == nil) != tc.valid {
+			t.Errorf("%s: valid = %t, got error %v", name, tc.valid, err)
+		}
+	}
+}
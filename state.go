@@ -0,0 +1,186 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"maps"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// stateVersion is bumped whenever persistedState changes incompatibly; a state
+// file of another version is ignored rather than misinterpreted.
+const stateVersion = 2
+
+// persistedState is the on-disk form of the debounce state (see confirmIssues),
+// so that a restarted watchdog picks up where the previous instance left off
+// instead of putting every check back in its initial state and re-announcing
+// every known issue.
+type persistedState struct {
+	Version   int
+	SavedAt   time.Time
+	LastCheck time.Time
+
+	RunCounts       map[string]int // by checkTarget.key
+	FailureStreaks  map[string]int
+	RecoveryStreaks map[string]int
+	Pending         map[string]persistedIssue
+	Confirmed       map[string]persistedIssue
+	LastReminded    map[string]time.Time
+	Uptime          map[string][]uptimeSpan
+	SchemeSnapshots map[string]schemeSnapshot
+	CTSeen          map[string]map[string]ctSeenCertificate
+}
+
+// persistedIssue mirrors issueEntry, whose fields are unexported.
+type persistedIssue struct {
+	IssueType issueType
+	Message   string
+	Kind      checkKind
+	Target    string
+	Condition string
+	FirstSeen time.Time
+	LastSeen  time.Time
+	WasDanger bool
+}
+
+func newPersistedIssue(issue issueEntry) persistedIssue {
+	return persistedIssue{
+		IssueType: issue.issueType,
+		Message:   issue.message,
+		Kind:      issue.kind,
+		Target:    issue.target,
+		Condition: issue.condition,
+		FirstSeen: issue.firstSeen,
+		LastSeen:  issue.lastSeen,
+		WasDanger: issue.wasDanger,
+	}
+}
+
+func (p persistedIssue) issueEntry() issueEntry {
+	return issueEntry{
+		issueType: p.IssueType,
+		message:   p.Message,
+		kind:      p.Kind,
+		target:    p.Target,
+		condition: p.Condition,
+		firstSeen: p.FirstSeen,
+		lastSeen:  p.LastSeen,
+		wasDanger: p.WasDanger,
+	}
+}
+
+// saveState writes the debounce state to path. The file is replaced
+// atomically, so a crash halfway never leaves a truncated state file behind.
+func saveState(path string) error {
+	_, when := currentState()
+	state := persistedState{
+		Version:         stateVersion,
+		SavedAt:         time.Now(),
+		LastCheck:       when,
+		FailureStreaks:  failureStreaks,
+		RecoveryStreaks: recoveryStreaks,
+		Pending:         make(map[string]persistedIssue, len(pendingSet)),
+		Confirmed:       make(map[string]persistedIssue, len(confirmedSet)),
+		LastReminded:    lastReminded,
+	}
+	uptimeMu.RLock()
+	state.Uptime = maps.Clone(uptime)
+	uptimeMu.RUnlock()
+	schemeSnapshotsMu.Lock()
+	state.SchemeSnapshots = maps.Clone(schemeSnapshots)
+	schemeSnapshotsMu.Unlock()
+	ctMu.Lock()
+	state.CTSeen = maps.Clone(ctSeen)
+	ctMu.Unlock()
+	state.RunCounts = make(map[string]int, len(runCounts))
+	for target, n := range runCounts {
+		state.RunCounts[target.key()] = n
+	}
+	for key, issue := range pendingSet {
+		state.Pending[key] = newPersistedIssue(issue)
+	}
+	for key, issue := range confirmedSet {
+		state.Confirmed[key] = newPersistedIssue(issue)
+	}
+
+	buf, err := json.Marshal(state)
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name()) // no-op once renamed
+	if _, err = tmp.Write(buf); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err = tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// loadState restores the debounce state saved by saveState and publishes the
+// confirmed issues, so that the first cycle after a restart diffs against what
+// was already reported. A missing file is not an error: it is what a first
+// start looks like.
+func loadState(path string) error {
+	buf, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	var state persistedState
+	if err = json.Unmarshal(buf, &state); err != nil {
+		return err
+	}
+	if state.Version != stateVersion {
+		return fmt.Errorf("unsupported state version %d (expected %d)", state.Version, stateVersion)
+	}
+
+	failureStreaks = orEmpty(state.FailureStreaks)
+	recoveryStreaks = orEmpty(state.RecoveryStreaks)
+	pendingSet = make(map[string]issueEntry, len(state.Pending))
+	for key, issue := range state.Pending {
+		pendingSet[key] = issue.issueEntry()
+	}
+	confirmedSet = make(map[string]issueEntry, len(state.Confirmed))
+	var confirmed issueEntries
+	for key, issue := range state.Confirmed {
+		confirmedSet[key] = issue.issueEntry()
+		confirmed = append(confirmed, confirmedSet[key])
+	}
+	lastReminded = orEmpty(state.LastReminded)
+	uptimeMu.Lock()
+	uptime = orEmpty(state.Uptime)
+	uptimeMu.Unlock()
+	schemeSnapshotsMu.Lock()
+	schemeSnapshots = orEmpty(state.SchemeSnapshots)
+	schemeSnapshotsMu.Unlock()
+	ctMu.Lock()
+	ctSeen = orEmpty(state.CTSeen)
+	ctMu.Unlock()
+	runCounts = make(map[checkTarget]int, len(state.RunCounts))
+	for key, n := range state.RunCounts {
+		runCounts[parseCheckTarget(key)] = n
+	}
+	setState(confirmed, state.LastCheck)
+
+	log.Printf("Restored state from %s (saved %s ago, %d confirmed issues)",
+		path, time.Since(state.SavedAt).Round(time.Second), len(confirmedSet))
+	return nil
+}
+
+func orEmpty[K comparable, V any](m map[K]V) map[K]V {
+	if m == nil {
+		return map[K]V{}
+	}
+	return m
+}
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestSaveAndLoadStateRoundTrip(t *testing.T) {
+	resetDebounceState(3)
+	defer setState(nil, time.Time{})
+	path := filepath.Join(t.TempDir(), "state.json")
+
+	confirmedMsg := "keyshare.yivi.app: cannot be reached"
+	pendingMsg := "yivi.app: cannot be reached"
+	firstSeen := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	confirmedSet[confirmedMsg] = issueEntry{
+		issueType: danger,
+		message:   confirmedMsg,
+		kind:      kindHealthCheck,
+		target:    "https://keyshare.yivi.app",
+		firstSeen: firstSeen,
+		lastSeen:  firstSeen.Add(time.Hour),
+	}
+	recoveryStreaks[confirmedMsg] = 1
+	failureStreaks[pendingMsg] = 2
+	pendingSet[pendingMsg] = issueEntry{issueType: danger, message: pendingMsg, firstSeen: firstSeen}
+	restarted := checkTarget{kindHealthCheck, "https://keyshare.yivi.app"}
+	runCounts[restarted] = 42
+	lastChecked := firstSeen.Add(2 * time.Hour)
+	setState(issueEntries{confirmedSet[confirmedMsg]}, lastChecked)
+
+	if err := saveState(path); err != nil {
+		t.Fatalf("saveState: %s", err)
+	}
+
+	// Simulate a restart.
+	resetDebounceState(3)
+	setState(nil, time.Time{})
+
+	if err := loadState(path); err != nil {
+		t.Fatalf("loadState: %s", err)
+	}
+	if runCounts[restarted] != 42 {
+		t.Errorf("run count = %d, want 42", runCounts[restarted])
+	}
+	if failureStreaks[pendingMsg] != 2 || !pendingSet[pendingMsg].firstSeen.Equal(firstSeen) {
+		t.Errorf("pending issue not restored: streak %d since %s", failureStreaks[pendingMsg], pendingSet[pendingMsg].firstSeen)
+	}
+	if recoveryStreaks[confirmedMsg] != 1 {
+		t.Errorf("recovery streak not restored: %v", recoveryStreaks)
+	}
+	got, ok := confirmedSet[confirmedMsg]
+	if !ok || got.issueType != danger || got.kind != kindHealthCheck || got.target != "https://keyshare.yivi.app" || !got.firstSeen.Equal(firstSeen) {
+		t.Errorf("confirmed issue not restored: %+v", got)
+	}
+
+	// The restored confirmed set is published, so the next cycle does not
+	// report it as new.
+	published, when := currentState()
+	if len(published) != 1 || published[0].message != confirmedMsg || !when.Equal(lastChecked) {
+		t.Errorf("restored state not published: %v at %s", published.messages(), when)
+	}
+	if newIssues, _ := difference(published, confirmIssues(issueEntries{issue(confirmedMsg)})); len(newIssues) != 0 {
+		t.Errorf("restored issue re-announced as new: %v", newIssues.messages())
+	}
+}
+
+// TestRestoredStateOfRemovedCheckIsForgotten: an issue of a check that was
+// removed from the configuration while the watchdog was down must not stay
+// confirmed forever.
+func TestRestoredStateOfRemovedCheckIsForgotten(t *testing.T) {
+	oldConf := conf
+	defer func() { conf = oldConf }()
+	resetDebounceState(1)
+	defer setState(nil, time.Time{})
+	path := filepath.Join(t.TempDir(), "state.json")
+
+	kept := issueEntry{issueType: danger, message: "yivi.app down", kind: kindHealthCheck, target: "https://yivi.app"}
+	removed := issueEntry{issueType: danger, message: "removed down", kind: kindHealthCheck, target: "https://removed.example"}
+	setState(confirmIssues(issueEntries{kept, removed}), time.Now())
+	if err := saveState(path); err != nil {
+		t.Fatalf("saveState: %s", err)
+	}
+
+	// Restart with a configuration without the removed check.
+	resetDebounceState(1)
+	setState(nil, time.Time{})
+	conf = Conf{HealthChecks: []HealthCheck{{RequestURL: "https://yivi.app"}}}
+	if err := loadState(path); err != nil {
+		t.Fatalf("loadState: %s", err)
+	}
+	forgetRemovedChecks(checkJobs(nil))
+
+	if _, ok := confirmedSet["removed down"]; ok {
+		t.Errorf("issue of removed check still confirmed")
+	}
+	if _, ok := confirmedSet["yivi.app down"]; !ok {
+		t.Errorf("issue of kept check was forgotten")
+	}
+	if published, _ := currentState(); len(published) != 1 || published[0].message != "yivi.app down" {
+		t.Errorf("expected only the kept issue to be published, got %v", published.messages())
+	}
+}
+
+func TestLoadStateMissingFileIsNotAnError(t *testing.T) {
+	resetDebounceState(3)
+	if err := loadState(filepath.Join(t.TempDir(), "does-not-exist.json")); err != nil {
+		t.Fatalf("expected a missing state file to be ignored, got %s", err)
+	}
+}
+
+func TestLoadStateRejectsOtherVersion(t *testing.T) {
+	resetDebounceState(3)
+	path := filepath.Join(t.TempDir(), "state.json")
+	if err := os.WriteFile(path, []byte(`{"Version": 999, "RunCounts": {"healthcheck|https://yivi.app": 7}}`), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := loadState(path); err == nil {
+		t.Fatal("expected an error for an unsupported state version")
+	}
+	if len(runCounts) != 0 {
+		t.Errorf("state of an unsupported version must not be applied, run counts = %v", runCounts)
+	}
+}
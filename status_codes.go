@@ -0,0 +1,88 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// statusCodeRange is an inclusive range of HTTP status codes.
+type statusCodeRange struct {
+	from, to int
+}
+
+// StatusCodes is a set of HTTP status codes. In the configuration it is a code
+// or a list of codes, where each can also be a class such as 2xx or a range
+// such as 200-204:
+//
+//	responsestatuscodes: 2xx
+//	responsestatuscodes: [200, 204, 301-302]
+type StatusCodes []statusCodeRange
+
+func (codes StatusCodes) contains(code int) bool {
+	for _, r := range codes {
+		if r.from <= code && code <= r.to {
+			return true
+		}
+	}
+	return false
+}
+
+func (codes StatusCodes) String() string {
+	parts := make([]string, len(codes))
+	for i, r := range codes {
+		switch {
+		case r.from == r.to:
+			parts[i] = strconv.Itoa(r.from)
+		case r.from%100 == 0 && r.to == r.from+99:
+			parts[i] = fmt.Sprintf("%dxx", r.from/100)
+		default:
+			parts[i] = fmt.Sprintf("%d-%d", r.from, r.to)
+		}
+	}
+	return strings.Join(parts, ", ")
+}
+
+func (codes *StatusCodes) UnmarshalYAML(node *yaml.Node) error {
+	var raw []string
+	if node.Kind == yaml.ScalarNode {
+		raw = []string{node.Value}
+	} else if err := node.Decode(&raw); err != nil {
+		return err
+	}
+	*codes = nil
+	for _, s := range raw {
+		r, err := parseStatusCodeRange(s)
+		if err != nil {
+			return fmt.Errorf("line %d: %w", node.Line, err)
+		}
+		*codes = append(*codes, r)
+	}
+	return nil
+}
+
+func parseStatusCodeRange(s string) (statusCodeRange, error) {
+	s = strings.TrimSpace(s)
+	invalid := fmt.Errorf("invalid status code %q", s)
+	if class, ok := strings.CutSuffix(strings.ToLower(s), "xx"); ok {
+		n, err := strconv.Atoi(class)
+		if err != nil || n < 1 || n > 5 {
+			return statusCodeRange{}, invalid
+		}
+		return statusCodeRange{n * 100, n*100 + 99}, nil
+	}
+	from, to, isRange := strings.Cut(s, "-")
+	if !isRange {
+		to = from
+	}
+	var r statusCodeRange
+	var err1, err2 error
+	r.from, err1 = strconv.Atoi(strings.TrimSpace(from))
+	r.to, err2 = strconv.Atoi(strings.TrimSpace(to))
+	if err1 != nil || err2 != nil || r.from < 100 || r.to > 599 || r.from > r.to {
+		return statusCodeRange{}, invalid
+	}
+	return r, nil
+}
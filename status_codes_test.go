@@ -0,0 +1,49 @@
+package main
+
+import (
+	"testing"
+
+	"gopkg.in/yaml.v3"
+)
+
+func TestStatusCodesUnmarshal(t *testing.T) {
+	for _, tc := range []struct {
+		yaml     string
+		accepted []int
+		rejected []int
+		str      string
+	}{
+		{"2xx", []int{200, 204, 299}, []int{199, 301}, "2xx"},
+		{"204", []int{204}, []int{200}, "204"},
+		{"[200, 204]", []int{200, 204}, []int{201}, "200, 204"},
+		{"[2xx, 301-302]", []int{250, 301, 302}, []int{303}, "2xx, 301-302"},
+	} {
+		var codes StatusCodes
+		if err := yaml.Unmarshal([]byte(tc.yaml), &codes); err != nil {
+			t.Errorf("%s: %s", tc.yaml, err)
+			continue
+		}
+		for _, code := range tc.accepted {
+			if !codes.contains(code) {
+				t.Errorf("%s: expected %d to be accepted", tc.yaml, code)
+			}
+		}
+		for _, code := range tc.rejected {
+			if codes.contains(code) {
+				t.Errorf("%s: expected %d to be rejected", tc.yaml, code)
+			}
+		}
+		if got := codes.String(); got != tc.str {
+			t.Errorf("%s: String() = %q, want %q", tc.yaml, got, tc.str)
+		}
+	}
+}
+
+func TestStatusCodesUnmarshalRejectsInvalid(t *testing.T) {
+	for _, raw := range []string{"ok", "6xx", "302-301", "[200, 99]"} {
+		var codes StatusCodes
+		if err := yaml.Unmarshal([]byte(raw), &codes); err == nil {
+			t.Errorf("expected %q to be rejected, got %v", raw, codes)
+		}
+	}
+}
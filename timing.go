@@ -107,6 +107,33 @@ func (t *requestTrace) summary() string {
 	)
 }
 
+// phases returns the durations of the phases that completed within the
+// attempt, keyed by the same names summary uses. Incomplete phases are left
+// out rather than reported as zero.
+func (t *requestTrace) phases() map[string]time.Duration {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	ret := make(map[string]time.Duration, 4)
+	add := func(name string, start, end time.Time) {
+		if !start.IsZero() && !end.IsZero() {
+			ret[name] = end.Sub(start)
+		}
+	}
+	add("dns", t.dnsStart, t.dnsDone)
+	add("connect", t.connStart, t.connDone)
+	add("tls", t.tlsStart, t.tlsDone)
+	add("ttfb", t.start, t.firstByte)
+	return ret
+}
+
+// elapsed returns the time since the start of the attempt.
+func (t *requestTrace) elapsed() time.Duration {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return time.Since(t.start)
+}
+
 // logFailedAttempt emits the phase breakdown for an attempt that errored or was
 // otherwise unhealthy. Healthy attempts are not logged, so normal cycles stay
 // quiet and the only trace output is for the events we want to diagnose.
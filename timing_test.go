@@ -84,3 +84,26 @@ func TestRequestTraceResetClearsPhases(t *testing.T) {
 		t.Errorf("reset did not clear phase timestamps: %s", tr.summary())
 	}
 }
+
+func TestRequestTracePhasesOmitsIncomplete(t *testing.T) {
+	now := time.Now()
+	tr := &requestTrace{
+		start:     now,
+		dnsStart:  now,
+		dnsDone:   now.Add(5 * time.Millisecond),
+		connStart: now.Add(5 * time.Millisecond),
+		connDone:  now.Add(15 * time.Millisecond),
+		tlsStart:  now.Add(15 * time.Millisecond),
+		// tlsDone and firstByte left zero: the handshake hung.
+	}
+
+	p := tr.phases()
+	if p["dns"] != 5*time.Millisecond || p["connect"] != 10*time.Millisecond {
+		t.Errorf("unexpected phase durations: %v", p)
+	}
+	for _, phase := range []string{"tls", "ttfb"} {
+		if _, ok := p[phase]; ok {
+			t.Errorf("incomplete phase %s should be omitted, got %v", phase, p)
+		}
+	}
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/rsa"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+)
+
+// checkTLS connects to target (see dialTLS) and inspects the TLS configuration
+// it presents: the chain is verified against roots (the system roots if nil)
+// and every problem is reported as an issue of its own. Expiry is left to the
+// certificate expiry check.
+func checkTLS(ctx context.Context, target string, roots *x509.CertPool) (ret issueEntries) {
+	log.Printf(" inspecting TLS of %s", target)
+	host, _, err := tlsAddress(target)
+	if err != nil {
+		return append(ret, issueEntry{issueType: warning, condition: "invalid", message: fmt.Sprintf("%s: invalid TLS check: %s", target, err)})
+	}
+	state, err := dialTLS(ctx, target)
+	if err != nil {
+		return append(ret, issueEntry{issueType: danger, condition: "unreachable", message: fmt.Sprintf("%s: TLS handshake failed: %s", target, err)})
+	}
+
+	for _, problem := range inspectTLS(host, state, roots, time.Now()) {
+		problem.message = fmt.Sprintf("%s: %s", target, problem.message)
+		ret = append(ret, problem)
+	}
+	return
+}
+
+// inspectTLS returns the problems with the TLS connection state of a
+// connection to host.
+func inspectTLS(host string, state tls.ConnectionState, roots *x509.CertPool, now time.Time) (ret issueEntries) {
+	certs := state.PeerCertificates
+	if len(certs) == 0 {
+		return append(ret, issueEntry{issueType: danger, condition: "no-certificate", message: "no certificate presented"})
+	}
+	leaf := certs[0]
+
+	if err := leaf.VerifyHostname(host); err != nil {
+		ret = append(ret, issueEntry{issueType: danger, condition: "hostname-mismatch", message: fmt.Sprintf("certificate is not valid for %s: %s", host, err)})
+	}
+
+	intermediates := x509.NewCertPool()
+	for _, cert := range certs[1:] {
+		intermediates.AddCert(cert)
+	}
+	_, err := leaf.Verify(x509.VerifyOptions{Roots: roots, Intermediates: intermediates, CurrentTime: now})
+	var invalid x509.CertificateInvalidError
+	var unknown x509.UnknownAuthorityError
+	switch {
+	case err == nil:
+	case errors.As(err, &invalid) && invalid.Reason == x509.Expired:
+		// Reported by the certificate expiry check, or below if not yet valid.
+	case errors.As(err, &unknown) && len(certs) == 1 && len(leaf.IssuingCertificateURL) > 0:
+		ret = append(ret, issueEntry{issueType: danger, condition: "incomplete-chain",
+			message: fmt.Sprintf("incomplete certificate chain: the intermediate certificate of %s is missing", leaf.Issuer.CommonName)})
+	default:
+		ret = append(ret, issueEntry{issueType: danger, condition: "untrusted", message: fmt.Sprintf("certificate chain does not verify: %s", err)})
+	}
+
+	for _, cert := range certs {
+		serial := cert.SerialNumber.Text(16)
+		subject := cert.Subject.CommonName
+		if now.Before(cert.NotBefore) {
+			ret = append(ret, issueEntry{issueType: danger, condition: "not-yet-valid:" + serial,
+				message: fmt.Sprintf("certificate %s is not valid until %s", subject, cert.NotBefore.UTC().Format(time.RFC3339))})
+		}
+		// The signature of a self-signed root is not checked by anyone.
+		if isWeakSignature(cert.SignatureAlgorithm) && !bytes.Equal(cert.RawIssuer, cert.RawSubject) {
+			ret = append(ret, issueEntry{issueType: warning, condition: "weak-signature:" + serial,
+				message: fmt.Sprintf("certificate %s is signed with %s", subject, cert.SignatureAlgorithm)})
+		}
+		if pk, ok := cert.PublicKey.(*rsa.PublicKey); ok && pk.N.BitLen() < 2048 {
+			ret = append(ret, issueEntry{issueType: warning, condition: "weak-key:" + serial,
+				message: fmt.Sprintf("certificate %s has a %d bit RSA key", subject, pk.N.BitLen())})
+		}
+	}
+
+	// Only certificates that name an OCSP responder can be stapled.
+	if len(leaf.OCSPServer) > 0 && len(state.OCSPResponse) == 0 {
+		ret = append(ret, issueEntry{issueType: info, condition: "no-ocsp-staple",
+			message: fmt.Sprintf("no OCSP response stapled, clients have to ask %s", strings.Join(leaf.OCSPServer, ", "))})
+	}
+	return
+}
+
+func isWeakSignature(alg x509.SignatureAlgorithm) bool {
+	switch alg {
+	case x509.MD2WithRSA, x509.MD5WithRSA, x509.SHA1WithRSA, x509.DSAWithSHA1, x509.ECDSAWithSHA1:
+		return true
+	}
+	return false
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCheckTLS(t *testing.T) {
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer srv.Close()
+	roots := x509.NewCertPool()
+	roots.AddCert(srv.Certificate())
+
+	if issues := checkTLS(context.Background(), srv.URL, roots); len(issues) != 0 {
+		t.Errorf("expected no issues, got %+v", issues)
+	}
+
+	// The certificate is for 127.0.0.1 and example.com only.
+	mismatched := strings.Replace(srv.URL, "127.0.0.1", "localhost", 1)
+	issues := checkTLS(context.Background(), mismatched, roots)
+	if len(issues) != 1 || issues[0].condition != "hostname-mismatch" {
+		t.Errorf("expected a hostname mismatch, got %+v", issues)
+	}
+
+	issues = checkTLS(context.Background(), srv.URL, x509.NewCertPool())
+	if len(issues) != 1 || issues[0].condition != "untrusted" {
+		t.Errorf("expected an untrusted chain, got %+v", issues)
+	}
+}
+
+// testCertificate creates a certificate from template, signed by parent (or
+// self-signed if nil), with a fresh RSA key of bits.
+func testCertificate(t *testing.T, template *x509.Certificate, parent *x509.Certificate, parentKey *rsa.PrivateKey, bits int) (*x509.Certificate, *rsa.PrivateKey) {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, bits)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if parent == nil {
+		parent, parentKey = template, key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, parent, &key.PublicKey, parentKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cert, key
+}
+
+func TestInspectTLS(t *testing.T) {
+	now := time.Now()
+	root, rootKey := testCertificate(t, &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "Test Root"},
+		NotBefore:             now.Add(-time.Hour),
+		NotAfter:              now.Add(24 * time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}, nil, nil, 2048)
+	intermediate, intermediateKey := testCertificate(t, &x509.Certificate{
+		SerialNumber:          big.NewInt(2),
+		Subject:               pkix.Name{CommonName: "Test Intermediate"},
+		NotBefore:             now.Add(-time.Hour),
+		NotAfter:              now.Add(24 * time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}, root, rootKey, 2048)
+	leaf := func(notBefore time.Time, bits int, alg x509.SignatureAlgorithm) *x509.Certificate {
+		cert, _ := testCertificate(t, &x509.Certificate{
+			SignatureAlgorithm:    alg,
+			SerialNumber:          big.NewInt(3),
+			Subject:               pkix.Name{CommonName: "yivi.app"},
+			DNSNames:              []string{"yivi.app"},
+			NotBefore:             notBefore,
+			NotAfter:              now.Add(24 * time.Hour),
+			IssuingCertificateURL: []string{"http://ca.example.com/intermediate.crt"},
+			OCSPServer:            []string{"http://ocsp.example.com"},
+			ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		}, intermediate, intermediateKey, bits)
+		return cert
+	}
+	roots := x509.NewCertPool()
+	roots.AddCert(root)
+
+	conditions := func(state tls.ConnectionState) (ret []string) {
+		for _, issue := range inspectTLS("yivi.app", state, roots, now) {
+			ret = append(ret, issue.condition)
+		}
+		return
+	}
+	for _, tc := range []struct {
+		name  string
+		state tls.ConnectionState
+		want  []string
+	}{
+		{"complete", tls.ConnectionState{PeerCertificates: []*x509.Certificate{leaf(now.Add(-time.Hour), 2048, 0), intermediate}, OCSPResponse: []byte{1}}, nil},
+		{"incomplete chain", tls.ConnectionState{PeerCertificates: []*x509.Certificate{leaf(now.Add(-time.Hour), 2048, 0)}, OCSPResponse: []byte{1}}, []string{"incomplete-chain"}},
+		{"no staple", tls.ConnectionState{PeerCertificates: []*x509.Certificate{leaf(now.Add(-time.Hour), 2048, 0), intermediate}}, []string{"no-ocsp-staple"}},
+		{"weak key", tls.ConnectionState{PeerCertificates: []*x509.Certificate{leaf(now.Add(-time.Hour), 1024, 0), intermediate}, OCSPResponse: []byte{1}}, []string{"weak-key:3"}},
+		{"sha1", tls.ConnectionState{PeerCertificates: []*x509.Certificate{leaf(now.Add(-time.Hour), 2048, x509.SHA1WithRSA), intermediate}, OCSPResponse: []byte{1}}, []string{"untrusted", "weak-signature:3"}},
+		{"not yet valid", tls.ConnectionState{PeerCertificates: []*x509.Certificate{leaf(now.Add(time.Hour), 2048, 0), intermediate}, OCSPResponse: []byte{1}}, []string{"not-yet-valid:3"}},
+	} {
+		if got := conditions(tc.state); strings.Join(got, ",") != strings.Join(tc.want, ",") {
+			t.Errorf("%s: got %q, want %q", tc.name, got, tc.want)
+		}
+	}
+}
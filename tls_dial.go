@@ -0,0 +1,129 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/smtp"
+	"net/url"
+	"time"
+)
+
+// defaultTLSPorts are the ports of the TLS targets that don't name one, by
+// URL scheme:
+//
+//	https://host               TLS on port 443
+//	tls://host:port            TLS right after connecting, as https
+//	smtp+starttls://host:587   SMTP, upgraded with STARTTLS
+//	postgres://host:5432       PostgreSQL, upgraded with an SSLRequest
+var defaultTLSPorts = map[string]string{
+	"https":         "443",
+	"tls":           "443",
+	"smtp+starttls": "587",
+	"postgres":      "5432",
+}
+
+// tlsDialTimeout bounds a single TLS handshake with a target, on top of the
+// deadline of the cycle.
+const tlsDialTimeout = 10 * time.Second
+
+// tlsAddress returns the host name to verify the certificate against, and the
+// address to connect to.
+func tlsAddress(target string) (host, addr string, err error) {
+	u, err := url.Parse(target)
+	if err != nil {
+		return "", "", err
+	}
+	defaultPort, ok := defaultTLSPorts[u.Scheme]
+	if !ok {
+		return "", "", fmt.Errorf("unsupported scheme %q", u.Scheme)
+	}
+	if u.Hostname() == "" {
+		return "", "", errors.New("no host")
+	}
+	port := u.Port()
+	if port == "" {
+		port = defaultPort
+	}
+	return u.Hostname(), net.JoinHostPort(u.Hostname(), port), nil
+}
+
+// dialTLS performs the TLS handshake with target in the way its URL scheme
+// says, and returns the resulting connection state. The certificates are not
+// verified: that is up to the caller, who wants to see even the bad ones.
+func dialTLS(ctx context.Context, target string) (tls.ConnectionState, error) {
+	host, addr, err := tlsAddress(target)
+	if err != nil {
+		return tls.ConnectionState{}, err
+	}
+	ctx, cancel := context.WithTimeout(ctx, tlsDialTimeout)
+	defer cancel()
+	config := &tls.Config{ServerName: host, InsecureSkipVerify: true}
+
+	conn, err := (&net.Dialer{}).DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return tls.ConnectionState{}, err
+	}
+	defer conn.Close()
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+
+	switch u, _ := url.Parse(target); u.Scheme {
+	case "smtp+starttls":
+		return startSMTPTLS(conn, host, config)
+	case "postgres":
+		return startPostgresTLS(ctx, conn, config)
+	default:
+		tlsConn := tls.Client(conn, config)
+		if err := tlsConn.HandshakeContext(ctx); err != nil {
+			return tls.ConnectionState{}, err
+		}
+		return tlsConn.ConnectionState(), nil
+	}
+}
+
+func startSMTPTLS(conn net.Conn, host string, config *tls.Config) (tls.ConnectionState, error) {
+	client, err := smtp.NewClient(conn, host)
+	if err != nil {
+		return tls.ConnectionState{}, err
+	}
+	defer client.Quit()
+	if ok, _ := client.Extension("STARTTLS"); !ok {
+		return tls.ConnectionState{}, errors.New("server does not offer STARTTLS")
+	}
+	if err := client.StartTLS(config); err != nil {
+		return tls.ConnectionState{}, err
+	}
+	state, _ := client.TLSConnectionState()
+	return state, nil
+}
+
+// postgresSSLRequest is the code of the message with which a PostgreSQL client
+// asks to switch to TLS before the startup message.
+const postgresSSLRequest = 80877103
+
+func startPostgresTLS(ctx context.Context, conn net.Conn, config *tls.Config) (tls.ConnectionState, error) {
+	var msg [8]byte
+	binary.BigEndian.PutUint32(msg[0:4], 8)
+	binary.BigEndian.PutUint32(msg[4:8], postgresSSLRequest)
+	if _, err := conn.Write(msg[:]); err != nil {
+		return tls.ConnectionState{}, err
+	}
+	var answer [1]byte
+	if _, err := io.ReadFull(conn, answer[:]); err != nil {
+		return tls.ConnectionState{}, err
+	}
+	if answer[0] != 'S' {
+		return tls.ConnectionState{}, errors.New("server does not support TLS")
+	}
+	tlsConn := tls.Client(conn, config)
+	if err := tlsConn.HandshakeContext(ctx); err != nil {
+		return tls.ConnectionState{}, err
+	}
+	return tlsConn.ConnectionState(), nil
+}
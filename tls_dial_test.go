@@ -0,0 +1,131 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"io"
+	"math/big"
+	"net"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// serveTLSTarget accepts connections on a local port and hands each to serve,
+// along with a TLS configuration for a certificate that expires in 10 days.
+func serveTLSTarget(t *testing.T, serve func(conn net.Conn, config *tls.Config)) (addr string, cert *x509.Certificate) {
+	t.Helper()
+	cert, key := testCertificate(t, &x509.Certificate{
+		SerialNumber: big.NewInt(42),
+		Subject:      pkix.Name{CommonName: "localhost"},
+		DNSNames:     []string{"localhost"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(10 * 24 * time.Hour),
+	}, nil, nil, 2048)
+	config := &tls.Config{Certificates: []tls.Certificate{{Certificate: [][]byte{cert.Raw}, PrivateKey: key}}}
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { l.Close() })
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				serve(conn, config)
+			}()
+		}
+	}()
+	return l.Addr().String(), cert
+}
+
+func TestDialTLSPostgres(t *testing.T) {
+	var refuse atomic.Bool
+	addr, cert := serveTLSTarget(t, func(conn net.Conn, config *tls.Config) {
+		var msg [8]byte
+		if _, err := io.ReadFull(conn, msg[:]); err != nil {
+			return
+		}
+		if refuse.Load() {
+			conn.Write([]byte{'N'})
+			return
+		}
+		conn.Write([]byte{'S'})
+		tls.Server(conn, config).Handshake()
+	})
+
+	target := "postgres://" + addr
+	issues := checkCertificateExpiryOf(context.Background(), newHTTPClient(), target, ExpiryHorizons{Warning: 30})
+	if len(issues) != 1 || issues[0].condition != "expiry:"+cert.SerialNumber.Text(16) {
+		t.Errorf("expected an expiring certificate, got %+v", issues)
+	}
+
+	refuse.Store(true)
+	if _, err := dialTLS(context.Background(), target); err == nil || !strings.Contains(err.Error(), "does not support TLS") {
+		t.Errorf("expected an error for a server without TLS, got %v", err)
+	}
+}
+
+func TestDialTLSSMTPStartTLS(t *testing.T) {
+	addr, cert := serveTLSTarget(t, func(conn net.Conn, config *tls.Config) {
+		var rw io.ReadWriter = conn
+		conn.Write([]byte("220 localhost ESMTP\r\n"))
+		r := bufio.NewReader(rw)
+		for {
+			line, err := r.ReadString('\n')
+			if err != nil {
+				return
+			}
+			switch cmd := strings.ToUpper(strings.Fields(line)[0]); cmd {
+			case "EHLO":
+				io.WriteString(rw, "250-localhost\r\n250 STARTTLS\r\n")
+			case "STARTTLS":
+				io.WriteString(rw, "220 ready\r\n")
+				tlsConn := tls.Server(conn, config)
+				if tlsConn.Handshake() != nil {
+					return
+				}
+				rw = tlsConn
+				r = bufio.NewReader(rw)
+			case "QUIT":
+				io.WriteString(rw, "221 bye\r\n")
+				return
+			default:
+				io.WriteString(rw, "502 unknown\r\n")
+			}
+		}
+	})
+
+	state, err := dialTLS(context.Background(), "smtp+starttls://"+addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(state.PeerCertificates) != 1 || !state.PeerCertificates[0].Equal(cert) {
+		t.Errorf("expected the certificate of the server, got %v", state.PeerCertificates)
+	}
+}
+
+func TestTLSAddress(t *testing.T) {
+	for target, want := range map[string]string{
+		"https://yivi.app":                         "yivi.app:443",
+		"tls://yivi.app:8443":                      "yivi.app:8443",
+		"smtp+starttls://smtp.yivi.app":            "smtp.yivi.app:587",
+		"postgres://db.privacybydesign.foundation": "db.privacybydesign.foundation:5432",
+	} {
+		if _, addr, err := tlsAddress(target); err != nil || addr != want {
+			t.Errorf("%s: got %s (%v), want %s", target, addr, err, want)
+		}
+	}
+	if _, _, err := tlsAddress("ftp://yivi.app"); err == nil {
+		t.Errorf("expected an unsupported scheme to be rejected")
+	}
+}
@@ -0,0 +1,186 @@
+package main
+
+import (
+	"encoding/csv"
+	"fmt"
+	"log"
+	"maps"
+	"net/http"
+	"slices"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// uptimeWindows are the periods over which availability is reported. The
+// longest one bounds how long outcomes are kept.
+var uptimeWindows = []struct {
+	name     string
+	duration time.Duration
+}{
+	{"24h", 24 * time.Hour},
+	{"7d", 7 * 24 * time.Hour},
+	{"30d", 30 * 24 * time.Hour},
+}
+
+// uptimeSpan is a period in which every run of a health check had the same
+// outcome. Consecutive spans of a target are contiguous, unless the watchdog
+// itself was not running in between.
+type uptimeSpan struct {
+	Start time.Time
+	End   time.Time // the last run of the span, or the first run of the next
+	Up    bool
+}
+
+var (
+	// uptimeMu guards uptime against the HTTP handlers; the check goroutine is
+	// the only writer.
+	uptimeMu sync.RWMutex
+	uptime   = map[string][]uptimeSpan{} // by health check target, oldest first
+)
+
+// recordUptime adds the outcome of a run of the health check of target at now.
+// A gap of more than maxGap since the previous run is not attributed to either
+// outcome: the watchdog was not looking.
+func recordUptime(target string, up bool, now time.Time, maxGap time.Duration) {
+	uptimeMu.Lock()
+	defer uptimeMu.Unlock()
+
+	spans := uptime[target]
+	switch last := len(spans) - 1; {
+	case last < 0 || now.Sub(spans[last].End) > maxGap:
+		spans = append(spans, uptimeSpan{Start: now, End: now, Up: up})
+	case spans[last].Up == up:
+		spans[last].End = now
+	default:
+		spans[last].End = now
+		spans = append(spans, uptimeSpan{Start: now, End: now, Up: up})
+	}
+
+	retention := uptimeWindows[len(uptimeWindows)-1].duration
+	for len(spans) > 0 && now.Sub(spans[0].End) > retention {
+		spans = spans[1:]
+	}
+	uptime[target] = spans
+}
+
+// pruneUptime forgets the targets that are no longer checked.
+func pruneUptime(targets map[checkTarget]bool) {
+	uptimeMu.Lock()
+	defer uptimeMu.Unlock()
+	for target := range uptime {
+		if !targets[checkTarget{kindHealthCheck, target}] {
+			delete(uptime, target)
+		}
+	}
+}
+
+// uptimeStats summarizes the outcomes of a health check over a window.
+type uptimeStats struct {
+	Window              string   `json:"window"`
+	AvailabilityPercent *float64 `json:"availability_percent"` // null without any runs in the window
+	Outages             int      `json:"outages"`
+	MTTRSeconds         float64  `json:"mttr_seconds"` // mean time to recovery of the outages that ended
+}
+
+type uptimeReport struct {
+	Target  string        `json:"target"`
+	Windows []uptimeStats `json:"windows"`
+}
+
+func newUptimeStats(spans []uptimeSpan, window string, from, now time.Time) uptimeStats {
+	stats := uptimeStats{Window: window}
+	var up, down, recovery time.Duration
+	var recovered int
+	for i, span := range spans {
+		if span.End.Before(from) {
+			continue
+		}
+		start := span.Start
+		if start.Before(from) {
+			start = from
+		}
+		d := span.End.Sub(start)
+		if span.Up {
+			up += d
+			continue
+		}
+		down += d
+		stats.Outages++
+		if i+1 < len(spans) && spans[i+1].Start.Equal(span.End) {
+			recovered++
+			recovery += span.End.Sub(span.Start)
+		}
+	}
+	if up+down > 0 {
+		availability := 100 * float64(up) / float64(up+down)
+		stats.AvailabilityPercent = &availability
+	} else if len(spans) > 0 && !spans[len(spans)-1].End.Before(from) {
+		// A single run: all or nothing.
+		availability := 0.0
+		if spans[len(spans)-1].Up {
+			availability = 100
+		}
+		stats.AvailabilityPercent = &availability
+	}
+	if recovered > 0 {
+		stats.MTTRSeconds = (recovery / time.Duration(recovered)).Seconds()
+	}
+	return stats
+}
+
+// uptimeReports returns the statistics of all health checks, by target.
+func uptimeReports(now time.Time) []uptimeReport {
+	uptimeMu.RLock()
+	defer uptimeMu.RUnlock()
+	reports := []uptimeReport{}
+	for _, target := range slices.Sorted(maps.Keys(uptime)) {
+		report := uptimeReport{Target: target}
+		for _, w := range uptimeWindows {
+			report.Windows = append(report.Windows, newUptimeStats(uptime[target], w.name, now.Add(-w.duration), now))
+		}
+		reports = append(reports, report)
+	}
+	return reports
+}
+
+// Handle /api/v1/uptime HTTP request.
+func uptimeHandler(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, uptimeReports(time.Now()))
+}
+
+// Handle /api/v1/uptime.csv HTTP request: the same numbers as /api/v1/uptime,
+// one row per target and window, for spreadsheets and reports.
+func uptimeCSVHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/csv")
+	w.Header().Set("Content-Disposition", `attachment; filename="uptime.csv"`)
+	out := csv.NewWriter(w)
+	out.Write([]string{"target", "window", "availability_percent", "outages", "mttr_seconds"})
+	for _, report := range uptimeReports(time.Now()) {
+		for _, stats := range report.Windows {
+			availability := ""
+			if stats.AvailabilityPercent != nil {
+				availability = strconv.FormatFloat(*stats.AvailabilityPercent, 'f', 3, 64)
+			}
+			out.Write([]string{
+				report.Target,
+				stats.Window,
+				availability,
+				strconv.Itoa(stats.Outages),
+				strconv.FormatFloat(stats.MTTRSeconds, 'f', 0, 64),
+			})
+		}
+	}
+	out.Flush()
+	if err := out.Error(); err != nil {
+		log.Printf("Error writing CSV response: %s", err)
+	}
+}
+
+// String formats the availability for the dashboard.
+func (s uptimeStats) String() string {
+	if s.AvailabilityPercent == nil {
+		return "-"
+	}
+	return fmt.Sprintf("%.2f%%", *s.AvailabilityPercent)
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"encoding/csv"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func resetUptime() {
+	uptimeMu.Lock()
+	uptime = map[string][]uptimeSpan{}
+	uptimeMu.Unlock()
+}
+
+// TestUptimeReportsOutagesAndRecovery: a day of five-minute runs with one
+// outage of an hour.
+func TestUptimeReportsOutagesAndRecovery(t *testing.T) {
+	resetUptime()
+	defer resetUptime()
+
+	const target = "https://yivi.app/health"
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	var now time.Time
+	for i := 0; i <= 24*12; i++ {
+		now = start.Add(time.Duration(i) * 5 * time.Minute)
+		down := now.Sub(start) >= 6*time.Hour && now.Sub(start) < 7*time.Hour
+		recordUptime(target, !down, now, 15*time.Minute)
+	}
+
+	reports := uptimeReports(now)
+	if len(reports) != 1 || reports[0].Target != target {
+		t.Fatalf("unexpected reports %+v", reports)
+	}
+	day := reports[0].Windows[0]
+	if day.Window != "24h" || day.Outages != 1 {
+		t.Fatalf("expected a single outage in the last 24h, got %+v", day)
+	}
+	if day.AvailabilityPercent == nil || *day.AvailabilityPercent < 95.8 || *day.AvailabilityPercent > 95.9 {
+		t.Errorf("availability = %s, want 23 of 24 hours", day)
+	}
+	if day.MTTRSeconds != time.Hour.Seconds() {
+		t.Errorf("mttr = %vs, want an hour", day.MTTRSeconds)
+	}
+}
+
+// TestUptimeIgnoresGaps: the time the watchdog was not running counts as
+// neither up nor down.
+func TestUptimeIgnoresGaps(t *testing.T) {
+	resetUptime()
+	defer resetUptime()
+
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	for m := 0; m <= 60; m += 5 {
+		recordUptime("a", true, start.Add(time.Duration(m)*time.Minute), 15*time.Minute)
+	}
+	recordUptime("a", false, start.Add(10*time.Hour), 15*time.Minute)
+	recordUptime("a", true, start.Add(10*time.Hour+5*time.Minute), 15*time.Minute)
+
+	stats := uptimeReports(start.Add(11 * time.Hour))[0].Windows[0]
+	if stats.AvailabilityPercent == nil || *stats.AvailabilityPercent != 100*60.0/65 {
+		t.Errorf("availability = %s, want 60 of 65 observed minutes", stats)
+	}
+}
+
+func TestUptimeCSVHandler(t *testing.T) {
+	resetUptime()
+	defer resetUptime()
+	recordUptime("https://yivi.app/health", true, time.Now(), time.Minute)
+
+	rec := httptest.NewRecorder()
+	uptimeCSVHandler(rec, httptest.NewRequest(http.MethodGet, "/api/v1/uptime.csv", nil))
+	rows, err := csv.NewReader(rec.Body).ReadAll()
+	if err != nil {
+		t.Fatalf("parse CSV: %s", err)
+	}
+	if len(rows) != 1+len(uptimeWindows) || rows[1][0] != "https://yivi.app/health" || rows[1][2] != "100.000" {
+		t.Errorf("unexpected CSV %q", rows)
+	}
+}
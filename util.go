@@ -80,3 +80,17 @@ func newHTTPClient() *retryablehttp.Client {
 
 	return client
 }
+
+// forkHTTPClient returns a client that shares base's connection pool and retry
+// settings, but on which hooks such as RequestLogHook and CheckRetry can be set
+// without affecting other users of base. Checks run in parallel and each
+// install their own hooks, so they cannot share a single client.
+func forkHTTPClient(base *retryablehttp.Client) *retryablehttp.Client {
+	client := retryablehttp.NewClient()
+	client.HTTPClient = base.HTTPClient
+	client.RetryMax = base.RetryMax
+	client.RetryWaitMin = base.RetryWaitMin
+	client.RetryWaitMax = base.RetryWaitMax
+	client.Logger = base.Logger
+	return client
+}
@@ -3,6 +3,8 @@ package main
 import (
 	"net/http"
 	"net/http/httptest"
+	"slices"
+	"sync"
 	"sync/atomic"
 	"testing"
 )
@@ -29,7 +31,7 @@ func TestPushToWebHooksContinuesOnError(t *testing.T) {
 	// healthy endpoint below is never reached.
 	conf = Conf{WebHooks: []string{badURL + "/?m=%s", good.URL + "/?m=%s"}}
 
-	pushToWebHooks(issueEntries{{issueType: danger, message: "boom"}})
+	pushToWebHooks(conf, issueEntries{{issueType: danger, message: "boom"}}, nil)
 
 	if got := atomic.LoadInt32(&hits); got != 1 {
 		t.Fatalf("expected the healthy webhook to be hit once despite the failing one, got %d", got)
@@ -49,14 +51,46 @@ func TestPushToWebHooksDeliversAllDangers(t *testing.T) {
 	defer func() { conf = oldConf }()
 	conf = Conf{WebHooks: []string{srv.URL + "/?m=%s", srv.URL + "/?m=%s"}}
 
-	pushToWebHooks(issueEntries{
+	pushToWebHooks(conf, issueEntries{
 		{issueType: danger, message: "one"},
 		{issueType: warning, message: "ignored"}, // warnings are filtered out
 		{issueType: danger, message: "two"},
-	})
+	}, nil)
 
 	// 2 dangers x 2 endpoints = 4 deliveries; the warning is not sent.
 	if got := atomic.LoadInt32(&hits); got != 4 {
 		t.Fatalf("expected 4 webhook deliveries (2 dangers x 2 endpoints), got %d", got)
 	}
 }
+
+// TestPushToWebHooksAnnouncesFixedDangers: fixed dangers, including issues that
+// were a danger before they became less severe, go to the fixedwebhooks
+// templates, or to the webhooks if there are none.
+func TestPushToWebHooksAnnouncesFixedDangers(t *testing.T) {
+	var (
+		mu       sync.Mutex
+		messages []string
+	)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		messages = append(messages, r.URL.Path+" "+r.URL.Query().Get("m"))
+	}))
+	defer srv.Close()
+
+	oldConf := conf
+	defer func() { conf = oldConf }()
+	fixed := issueEntries{{issueType: danger, message: "down"}, {issueType: warning, message: "ignored"}, {issueType: warning, message: "slow", wasDanger: true}}
+
+	conf = Conf{WebHooks: []string{srv.URL + "/new?m=%s"}}
+	pushToWebHooks(conf, nil, fixed)
+	conf = Conf{WebHooks: []string{srv.URL + "/new?m=%s"}, FixedWebHooks: []string{srv.URL + "/fixed?m=%s"}}
+	pushToWebHooks(conf, nil, fixed)
+
+	mu.Lock()
+	defer mu.Unlock()
+	want := []string{"/new Watchdog: fixed: down", "/new Watchdog: fixed: slow", "/fixed Watchdog: fixed: down", "/fixed Watchdog: fixed: slow"}
+	if !slices.Equal(messages, want) {
+		t.Errorf("got deliveries %q, want %q", messages, want)
+	}
+}